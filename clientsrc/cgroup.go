@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cgroup 当前进程所属的 cgroup
+type cgroup struct {
+	v2     bool
+	memory string // memory 控制器目录
+	cpu    string // cpu 控制器目录(v1 中 cpuacct 与 cpu 通常挂载在一起)
+	cpuacc string // cpuacct 控制器目录
+}
+
+// detectCgroup 探测 cgroup 版本及当前进程所在的控制器目录
+// 未挂载 cgroupfs 时返回 nil
+func detectCgroup() *cgroup {
+	root := sysPath("fs", "cgroup")
+	paths := readSelfCgroup()
+
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		dir := cgroupDir(root, paths[""])
+		return &cgroup{v2: true, memory: dir, cpu: dir, cpuacc: dir}
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "memory")); err != nil {
+		return nil
+	}
+	return &cgroup{
+		memory: cgroupDir(filepath.Join(root, "memory"), paths["memory"]),
+		cpu:    cgroupDir(filepath.Join(root, "cpu"), paths["cpu"]),
+		cpuacc: cgroupDir(filepath.Join(root, "cpuacct"), paths["cpuacct"]),
+	}
+}
+
+// readSelfCgroup 解析 /proc/self/cgroup, 返回 控制器 -> 路径
+// cgroup v2 的统一层级以空字符串为键
+func readSelfCgroup() map[string]string {
+	paths := make(map[string]string)
+	f, err := os.Open(procPath("self", "cgroup"))
+	if err != nil {
+		return paths
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			paths[controller] = parts[2]
+		}
+	}
+	return paths
+}
+
+// cgroupDir 返回控制器下当前 cgroup 的目录
+// 容器内通常只挂载了自身的 cgroup, 此时 /proc/self/cgroup 中的路径并不存在, 直接使用挂载点
+func cgroupDir(mount, path string) string {
+	if path != "" && path != "/" {
+		dir := filepath.Join(mount, path)
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+	}
+	return mount
+}
+
+// memoryUsage 返回 cgroup 内存限制与已用内存(KB), 未设置限制时 ok 为 false
+// 已用内存不含可回收的非活跃文件缓存, 与 docker stats 一致
+func (cg *cgroup) memoryUsage() (total, used uint64, ok bool) {
+	var limit, usage uint64
+	var stat map[string]uint64
+	if cg.v2 {
+		limit, ok = readCgroupUint(filepath.Join(cg.memory, "memory.max"))
+		usage, _ = readCgroupUint(filepath.Join(cg.memory, "memory.current"))
+		stat = readCgroupStat(filepath.Join(cg.memory, "memory.stat"))
+		usage = saturatingSub(usage, stat["inactive_file"])
+	} else {
+		limit, ok = readCgroupUint(filepath.Join(cg.memory, "memory.limit_in_bytes"))
+		usage, _ = readCgroupUint(filepath.Join(cg.memory, "memory.usage_in_bytes"))
+		stat = readCgroupStat(filepath.Join(cg.memory, "memory.stat"))
+		usage = saturatingSub(usage, stat["total_inactive_file"])
+	}
+	if !ok {
+		return 0, 0, false
+	}
+	return limit / 1024, usage / 1024, true
+}
+
+// cpuQuota 返回 CPU 配额(核数), 未设置限制时 ok 为 false
+func (cg *cgroup) cpuQuota() (cores float64, ok bool) {
+	if cg.v2 {
+		data, err := os.ReadFile(filepath.Join(cg.cpu, "cpu.max"))
+		if err != nil {
+			return 0, false
+		}
+		fields := strings.Fields(string(data))
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0, false
+		}
+		quota, err1 := strconv.ParseFloat(fields[0], 64)
+		period, err2 := strconv.ParseFloat(fields[1], 64)
+		if err1 != nil || err2 != nil || quota <= 0 || period <= 0 {
+			return 0, false
+		}
+		return quota / period, true
+	}
+
+	quota, err1 := readCgroupInt(filepath.Join(cg.cpu, "cpu.cfs_quota_us"))
+	period, err2 := readCgroupInt(filepath.Join(cg.cpu, "cpu.cfs_period_us"))
+	if err1 != nil || err2 != nil || quota <= 0 || period <= 0 {
+		return 0, false
+	}
+	return float64(quota) / float64(period), true
+}
+
+// usageTime 返回 cgroup 累计使用的 CPU 时间
+func (cg *cgroup) usageTime() (time.Duration, bool) {
+	if cg.v2 {
+		usec, ok := readCgroupStat(filepath.Join(cg.cpuacc, "cpu.stat"))["usage_usec"]
+		return time.Duration(usec) * time.Microsecond, ok
+	}
+	nsec, err := readCgroupInt(filepath.Join(cg.cpuacc, "cpuacct.usage"))
+	return time.Duration(nsec), err == nil
+}
+
+// cgroupCPUSample 返回按 cgroup CPU 配额计算使用率的采样函数
+// 未处于 cgroup 中或未设置 CPU 限制时 ok 为 false, 调用方应使用宿主机数据
+func cgroupCPUSample() (sample func() (float64, bool), ok bool) {
+	cg := detectCgroup()
+	if cg == nil {
+		return nil, false
+	}
+	if _, limited := cg.cpuQuota(); !limited {
+		return nil, false
+	}
+
+	prevUsage, _ := cg.usageTime()
+	prevTime := time.Now()
+	return func() (float64, bool) {
+		cores, limited := cg.cpuQuota()
+		usage, ok := cg.usageTime()
+		if !limited || !ok {
+			return 0, false
+		}
+		now := time.Now()
+		elapsed := now.Sub(prevTime)
+		delta := usage - prevUsage
+		prevUsage, prevTime = usage, now
+		if elapsed <= 0 || delta < 0 {
+			return 0, true
+		}
+		percent := float64(delta) / (float64(elapsed) * cores) * 100
+		if percent > 100 {
+			percent = 100
+		}
+		return percent, true
+	}, true
+}
+
+// readCgroupUint 读取单值文件, 值为 max 或超过物理内存的哨兵值时视为未限制
+func readCgroupUint(file string) (uint64, bool) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, false
+	}
+	text := strings.TrimSpace(string(data))
+	if text == "max" {
+		return 0, false
+	}
+	val, err := strconv.ParseUint(text, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	// cgroup v1 未限制时为接近 int64 上限且按页对齐的数值
+	if val >= 1<<62 {
+		return 0, false
+	}
+	return val, true
+}
+
+func readCgroupInt(file string) (int64, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// readCgroupStat 解析 "key value" 格式的统计文件
+func readCgroupStat(file string) map[string]uint64 {
+	stat := make(map[string]uint64)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return stat
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if val, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			stat[fields[0]] = val
+		}
+	}
+	return stat
+}
+
+func saturatingSub(a, b uint64) uint64 {
+	if b > a {
+		return 0
+	}
+	return a - b
+}
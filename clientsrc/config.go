@@ -0,0 +1,481 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+// Config 客户端完整配置
+// 可由 -config 指定的 JSON 文件提供, 命令行中显式给出的参数优先于文件中的值
+type Config struct {
+	Host         string  `json:"host"`
+	Port         int     `json:"port"`
+	User         string  `json:"user"`
+	Password     string  `json:"password"`
+	DSN          string  `json:"dsn"`
+	Interval     float64 `json:"interval"`
+	Vnstat       bool    `json:"vnstat"`
+	Extended     bool    `json:"extended"`
+	ExtendedFile string  `json:"extended_file"` // 扩展数据写入该文件, 不再随 update 发送
+	Container    bool    `json:"container"`
+	// Custom 附加到 custom 字段的内容, 见 customSections
+	Custom []string `json:"custom"`
+	Rootfs string   `json:"rootfs"`
+	Procfs string   `json:"procfs"`
+	Sysfs  string   `json:"sysfs"`
+	// Periods 各采样线程的周期(秒), 未设置时使用 Interval
+	Periods    map[string]float64 `json:"periods"`
+	Probe      ProbeConfig        `json:"probe"`
+	Interfaces InterfaceConfig    `json:"interfaces"`
+	Memory     MemoryConfig       `json:"memory"`
+	Disk       DiskConfig         `json:"disk"`
+	DiskIO     DiskIOConfig       `json:"diskio"`
+	Traffic    TrafficConfig      `json:"traffic"`
+	Monitor    MonitorConfig      `json:"monitor"`
+	Online     OnlineConfig       `json:"online"`
+}
+
+// ProbeConfig 延迟探测配置
+type ProbeConfig struct {
+	CU    string `json:"cu"`
+	CT    string `json:"ct"`
+	CM    string `json:"cm"`
+	Port  int    `json:"port"`
+	Proto string `json:"proto"` // ipv4 / ipv6, 其余值表示不限
+	// Type 默认探测方式: tcp 测量TCP连接耗时, icmp 发送 ICMP 回显
+	Type    string  `json:"type"`
+	Timeout float64 `json:"timeout"` // 默认超时(秒), 超时计为丢包
+	// Targets 延迟探测目标, 为空时探测 CU/CT/CM 三个主机
+	Targets []ProbeTarget `json:"targets"`
+	// Legacy 上报到服务器 ping_10010/ping_189/ping_10086 等字段的目标名称
+	Legacy ProbeLegacy `json:"legacy"`
+	// Schedule 默认调度, 可被目标自己的 schedule 覆盖
+	Schedule ProbeSchedule `json:"schedule"`
+
+	network string // 由 Proto 换算出的 net 包网络类型: ip4 / ip6 / ip
+}
+
+// ProbeTarget 延迟探测目标, 未设置的端口、协议偏好、探测方式与超时沿用 ProbeConfig 中的值
+type ProbeTarget struct {
+	Name     string  `json:"name"`
+	Host     string  `json:"host"`
+	Port     int     `json:"port"`
+	Proto    string  `json:"proto"`
+	Interval float64 `json:"interval"` // 探测周期(秒), 默认使用 ping 采样周期
+	Type     string  `json:"type"`
+	Timeout  float64 `json:"timeout"`
+	// Schedule 中未设置的项使用 ProbeConfig.Schedule
+	Schedule ProbeSchedule `json:"schedule"`
+
+	network string
+}
+
+// ProbeSchedule 探测调度, 见 probeScheduler
+type ProbeSchedule struct {
+	Jitter          float64 `json:"jitter"`           // 每次间隔随机增减的最大秒数, 0 表示固定周期
+	FailureInterval float64 `json:"failure_interval"` // 探测失败后改用的周期(秒), 0 表示不启用
+}
+
+// OnlineConfig online4/online6 的检查配置
+// 每个IP版本分别检查适用的目标, 任一目标成功即视为在线; 检查周期为 periods.online
+type OnlineConfig struct {
+	Targets []OnlineTarget `json:"targets"` // 为空时连接 ipv4/ipv6.google.com:80
+	Timeout float64        `json:"timeout"` // 每轮检查的超时(秒), 默认2
+}
+
+// OnlineTarget 在线检查目标
+type OnlineTarget struct {
+	Type    string `json:"type"`    // tcp / http / dns
+	Address string `json:"address"` // tcp: host:port, http: URL, dns: 服务器地址, 默认端口53
+	Query   string `json:"query"`   // dns 查询的域名, 默认为根域
+	Family  string `json:"family"`  // ipv4 / ipv6, 为空时两个IP版本都检查
+}
+
+// MonitorConfig 服务器下发的自定义监控(monitors)在本地的配置
+type MonitorConfig struct {
+	Schedule ProbeSchedule `json:"schedule"`
+	// Overlay 按监控项名称覆盖服务器下发的检查选项
+	Overlay map[string]MonitorOptions `json:"overlay"`
+}
+
+// MonitorOptions 监控项的检查选项
+// 可在 monitor.overlay 中按名称设置, 也会读取监控行中的同名字段(后者优先级较低);
+// 本仓库的服务器只下发 name/host/interval/type, 因此实际只能通过 overlay 设置
+type MonitorOptions struct {
+	HTTP *HTTPCheck `json:"http"`
+	TLS  *TLSCheck  `json:"tls"`
+}
+
+// TLSCheck 基于 TLS 的监控的校验规则, 未设置时使用系统根证书校验证书链与主机名
+type TLSCheck struct {
+	Insecure   bool   `json:"insecure"`    // 不校验证书链与主机名, 仍记录证书信息
+	CA         string `json:"ca"`          // PEM 格式的 CA 证书文件, 设置后不再使用系统根证书
+	ServerName string `json:"server_name"` // SNI 与校验证书时使用的主机名, 默认取自监控地址
+	Cert       string `json:"cert"`        // 双向 TLS 使用的客户端证书文件(PEM)
+	Key        string `json:"key"`         // 客户端证书的私钥文件(PEM)
+	MinVersion string `json:"min_version"` // 1.0 / 1.1 / 1.2 / 1.3, 默认1.2
+	ExpiryDays int    `json:"expiry_days"` // 证书剩余天数不超过该值时在 custom 中标出, 默认14
+}
+
+// HTTPCheck http/https 监控的请求内容与判定规则
+type HTTPCheck struct {
+	Method  string            `json:"method"` // 默认 GET
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+	// Status 视为正常的状态码, 如 "200"、"2xx"、"200-399", 为空时为 200/204/301/302/401
+	Status []string `json:"status"`
+	// Match 响应正文需包含的内容, MatchRegex 时为正则表达式, MatchAbsent 时要求不出现
+	Match       string `json:"match"`
+	MatchRegex  bool   `json:"match_regex"`
+	MatchAbsent bool   `json:"match_absent"`
+	// MaxSize 响应正文的最大字节数, 超过计为失败, 0 表示不限制
+	MaxSize         int64 `json:"max_size"`
+	FollowRedirects bool  `json:"follow_redirects"`
+}
+
+// ProbeLegacy 服务器原有的三个延迟字段各自对应的探测目标
+type ProbeLegacy struct {
+	CU string `json:"cu"` // ping_10010 / time_10010
+	CT string `json:"ct"` // ping_189 / time_189
+	CM string `json:"cm"` // ping_10086 / time_10086
+}
+
+// InterfaceConfig 网卡过滤配置, 名称支持 path.Match 通配符, 类型见 interfaceTypes
+// 配置了包含规则时只统计匹配的网卡, 否则统计除内置虚拟网卡与绑定成员以外的全部网卡
+type InterfaceConfig struct {
+	Include      []string `json:"include"`
+	Exclude      []string `json:"exclude"`
+	IncludeTypes []string `json:"include_types"`
+	ExcludeTypes []string `json:"exclude_types"`
+}
+
+// DiskConfig 磁盘容量统计配置, 均支持 path.Match 通配符
+// IncludeFstypes 为空时使用内置的 ValidFs; IncludeMounts 为空时不限挂载点
+type DiskConfig struct {
+	IncludeFstypes []string `json:"include_fstypes"`
+	ExcludeFstypes []string `json:"exclude_fstypes"`
+	IncludeMounts  []string `json:"include_mounts"`
+	ExcludeMounts  []string `json:"exclude_mounts"`
+}
+
+// DiskIOConfig 磁盘IO统计的设备过滤, 支持 path.Match 通配符
+// Include 为空时统计除 loop/ram 等虚拟设备以外的全部整盘
+type DiskIOConfig struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+}
+
+// TrafficConfig 累计流量与账期配置
+// 账本随状态文件保存, 因此 cycle 模式与配额都需要设置 StateFile
+type TrafficConfig struct {
+	StateFile      string  `json:"state_file"`      // 状态文件, 为空时上报 /proc/net/dev 的原始计数
+	SaveInterval   float64 `json:"save_interval"`   // 保存状态文件的间隔(秒), 默认60
+	Mode           string  `json:"mode"`            // total / cycle
+	ResetDay       int     `json:"reset_day"`       // 账期重置日, 与服务器的 monthstart 相同, 1-28
+	Quota          float64 `json:"quota"`           // 每个账期的流量配额(GiB), 0 表示不限
+	QuotaDirection string  `json:"quota_direction"` // 计入配额的流量: sum / in / out / max
+	// Vnstat 开启 vnstat 时的网卡与统计窗口
+	Vnstat VnstatConfig `json:"vnstat"`
+}
+
+// VnstatConfig vnstat 流量统计配置
+type VnstatConfig struct {
+	Interfaces []string `json:"interfaces"` // 为空时按 interfaces 过滤规则选择数据库中的网卡
+	Window     string   `json:"window"`     // today / month / cycle, 默认 month
+}
+
+// MemoryConfig 内存用量计算配置
+type MemoryConfig struct {
+	Mode   string `json:"mode"`    // legacy / available
+	ZfsArc bool   `json:"zfs_arc"` // 从已用内存中扣除 ZFS ARC
+}
+
+// 命令行参数与配置字段的对应关系, 用于让显式给出的参数覆盖配置文件
+var flagOverrides = map[string]func(dst, src *Config){
+	"host":         func(dst, src *Config) { dst.Host = src.Host },
+	"port":         func(dst, src *Config) { dst.Port = src.Port },
+	"user":         func(dst, src *Config) { dst.User = src.User },
+	"password":     func(dst, src *Config) { dst.Password = src.Password },
+	"dsn":          func(dst, src *Config) { dst.DSN = src.DSN },
+	"interval":     func(dst, src *Config) { dst.Interval = src.Interval },
+	"vnstat":       func(dst, src *Config) { dst.Vnstat = src.Vnstat },
+	"extended":     func(dst, src *Config) { dst.Extended = src.Extended },
+	"extendedFile": func(dst, src *Config) { dst.ExtendedFile = src.ExtendedFile },
+	"custom":       func(dst, src *Config) { dst.Custom = src.Custom },
+	"trafficState": func(dst, src *Config) { dst.Traffic.StateFile = src.Traffic.StateFile },
+	"trafficMode":  func(dst, src *Config) { dst.Traffic.Mode = src.Traffic.Mode },
+	"vnstatIface":  func(dst, src *Config) { dst.Traffic.Vnstat.Interfaces = src.Traffic.Vnstat.Interfaces },
+	"vnstatWindow": func(dst, src *Config) { dst.Traffic.Vnstat.Window = src.Traffic.Vnstat.Window },
+	"resetDay":     func(dst, src *Config) { dst.Traffic.ResetDay = src.Traffic.ResetDay },
+	"trafficQuota": func(dst, src *Config) { dst.Traffic.Quota = src.Traffic.Quota },
+	"memoryMode":   func(dst, src *Config) { dst.Memory.Mode = src.Memory.Mode },
+	"zfsArc":       func(dst, src *Config) { dst.Memory.ZfsArc = src.Memory.ZfsArc },
+	"container":    func(dst, src *Config) { dst.Container = src.Container },
+	"rootfs":       func(dst, src *Config) { dst.Rootfs = src.Rootfs },
+	"procfs":       func(dst, src *Config) { dst.Procfs = src.Procfs },
+	"sysfs":        func(dst, src *Config) { dst.Sysfs = src.Sysfs },
+	"cu":           func(dst, src *Config) { dst.Probe.CU = src.Probe.CU },
+	"ct":           func(dst, src *Config) { dst.Probe.CT = src.Probe.CT },
+	"cm":           func(dst, src *Config) { dst.Probe.CM = src.Probe.CM },
+	"probePort":    func(dst, src *Config) { dst.Probe.Port = src.Probe.Port },
+	"proto":        func(dst, src *Config) { dst.Probe.Proto = src.Probe.Proto },
+	"probeType":    func(dst, src *Config) { dst.Probe.Type = src.Probe.Type },
+	"probeTimeout": func(dst, src *Config) { dst.Probe.Timeout = src.Probe.Timeout },
+}
+
+var currentConfig atomic.Pointer[Config]
+
+// getConfig 返回当前生效的配置, 调用方不得修改返回值
+func getConfig() *Config {
+	return currentConfig.Load()
+}
+
+// flagConfig 由命令行参数(含默认值)构造配置
+func flagConfig() *Config {
+	return &Config{
+		Host:         *Server,
+		Port:         *Port,
+		User:         *User,
+		Password:     *Password,
+		DSN:          *DSN,
+		Interval:     *Interval,
+		Vnstat:       *IsVnstat,
+		Extended:     *Extended,
+		ExtendedFile: *ExtendedFile,
+		Container:    *Container,
+		Custom:       splitList(*CustomSections),
+		Rootfs:       *Rootfs,
+		Procfs:       *Procfs,
+		Sysfs:        *Sysfs,
+		Probe: ProbeConfig{
+			CU:      *CU,
+			CT:      *CT,
+			CM:      *CM,
+			Port:    *ProbePort,
+			Proto:   *ProbeProtocolPrefer,
+			Type:    *ProbeType,
+			Timeout: *ProbeTimeout,
+		},
+		Traffic: TrafficConfig{
+			StateFile: *TrafficState,
+			Mode:      *TrafficMode,
+			ResetDay:  *ResetDay,
+			Quota:     *TrafficQuota,
+			Vnstat: VnstatConfig{
+				Interfaces: splitList(*VnstatIfaces),
+				Window:     *VnstatWindow,
+			},
+		},
+		Memory: MemoryConfig{
+			Mode:   *MemoryMode,
+			ZfsArc: *ZfsArc,
+		},
+	}
+}
+
+// loadConfig 按 默认值 -> 配置文件 -> 显式命令行参数 的顺序合成配置并校验
+func loadConfig(file string) (*Config, error) {
+	flags := flagConfig()
+	cfg := flagConfig()
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("读取配置文件失败: %w", err)
+		}
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("解析配置文件失败: %w", err)
+		}
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if override, ok := flagOverrides[f.Name]; ok {
+			override(cfg, flags)
+		}
+	})
+
+	if err := parseDSN(cfg); err != nil {
+		return nil, err
+	}
+	if err := validateConfig(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// parseDSN 解析DSN参数, 覆盖用户名、密码、主机与端口
+func parseDSN(cfg *Config) error {
+	if cfg.DSN == "" {
+		return nil
+	}
+	parts := strings.Split(cfg.DSN, "@")
+	if len(parts) != 2 {
+		return fmt.Errorf("DSN 格式错误, 缺少 @ 符号, 应为 username:password@host:port")
+	}
+	auth := strings.Split(parts[0], ":")
+	if len(auth) != 2 {
+		return fmt.Errorf("DSN 格式错误, 缺少 : 号符, 应为 username:password@host:port")
+	}
+	cfg.User = auth[0]
+	cfg.Password = auth[1]
+
+	addr := strings.Split(parts[1], ":")
+	cfg.Host = addr[0]
+	if len(addr) == 2 {
+		port, err := strconv.Atoi(addr[1])
+		if err == nil {
+			cfg.Port = port
+		}
+	}
+	return nil
+}
+
+// validateConfig 验证参数有效性
+func validateConfig(cfg *Config) error {
+	if cfg.Port < 1 || cfg.Port > 65535 {
+		return fmt.Errorf("端口号必须在1到65535之间")
+	}
+	if cfg.Host == "" || cfg.User == "" || cfg.Password == "" {
+		return fmt.Errorf("主机地址、用户名和密码不能为空")
+	}
+	if cfg.Interval <= 0 {
+		return fmt.Errorf("数据发送间隔必须大于0")
+	}
+	switch cfg.Memory.Mode {
+	case memoryModeLegacy, memoryModeAvailable:
+	default:
+		return fmt.Errorf("未知的内存计算方式 %q", cfg.Memory.Mode)
+	}
+	for _, name := range cfg.Custom {
+		if _, ok := customSections[name]; !ok {
+			return fmt.Errorf("未知的 custom 内容 %q", name)
+		}
+	}
+	if cfg.Rootfs == "" {
+		cfg.Rootfs = "/"
+	}
+	for name, sec := range cfg.Periods {
+		if _, ok := periodNames[name]; !ok {
+			return fmt.Errorf("未知的采样线程 %q", name)
+		}
+		if sec < 0 {
+			return fmt.Errorf("采样线程 %s 的周期不能为负数", name)
+		}
+	}
+	for _, pattern := range append(cfg.Interfaces.Include, cfg.Interfaces.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("网卡匹配规则 %q 无效: %w", pattern, err)
+		}
+	}
+	for _, pattern := range append(cfg.DiskIO.Include, cfg.DiskIO.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("磁盘IO设备匹配规则 %q 无效: %w", pattern, err)
+		}
+	}
+	for _, pattern := range cfg.Disk.patterns() {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("磁盘匹配规则 %q 无效: %w", pattern, err)
+		}
+	}
+	if err := cfg.Monitor.Schedule.validate(); err != nil {
+		return fmt.Errorf("自定义监控的%w", err)
+	}
+	for name, opts := range cfg.Monitor.Overlay {
+		if err := opts.validate(); err != nil {
+			return fmt.Errorf("monitor.overlay 中 %s 的%w", name, err)
+		}
+	}
+	if err := validateOnline(&cfg.Online); err != nil {
+		return err
+	}
+	if err := validateTraffic(cfg); err != nil {
+		return err
+	}
+	return validateProbe(&cfg.Probe)
+}
+
+// validateTraffic 验证账期配置, 配置了配额时自动在 custom 字段中展示流量
+func validateTraffic(cfg *Config) error {
+	t := &cfg.Traffic
+	if t.Mode == "" {
+		t.Mode = trafficModeTotal
+	}
+	if t.Mode != trafficModeTotal && t.Mode != trafficModeCycle {
+		return fmt.Errorf("未知的流量上报方式 %q", t.Mode)
+	}
+	if t.ResetDay == 0 {
+		t.ResetDay = 1
+	}
+	if t.ResetDay < 1 || t.ResetDay > 28 {
+		return fmt.Errorf("账期重置日必须在1到28之间")
+	}
+	switch t.QuotaDirection {
+	case "":
+		t.QuotaDirection = "sum"
+	case "sum", "in", "out", "max":
+	default:
+		return fmt.Errorf("未知的配额计算方式 %q", t.QuotaDirection)
+	}
+	switch t.Vnstat.Window {
+	case "":
+		t.Vnstat.Window = vnstatWindowMonth
+	case vnstatWindowToday, vnstatWindowMonth, vnstatWindowCycle:
+	default:
+		return fmt.Errorf("未知的 vnstat 统计窗口 %q", t.Vnstat.Window)
+	}
+	if t.Quota < 0 {
+		return fmt.Errorf("流量配额不能为负数")
+	}
+	if (t.Mode == trafficModeCycle || t.Quota > 0) && t.StateFile == "" {
+		return fmt.Errorf("按账期统计流量需要设置流量状态文件")
+	}
+	if t.Quota > 0 && !contains(cfg.Custom, "traffic") {
+		cfg.Custom = append(cfg.Custom, "traffic")
+	}
+	return nil
+}
+
+// splitList 拆分逗号分隔的命令行参数, 忽略空项
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// endpointChanged 判断服务器地址或认证信息是否变化
+func endpointChanged(old, cfg *Config) bool {
+	return old.Host != cfg.Host || old.Port != cfg.Port || old.User != cfg.User || old.Password != cfg.Password
+}
+
+// watchReload 收到 SIGHUP 时重新读取配置文件
+// 只重启配置发生变化的后台监控, 服务器地址或认证信息变化时才重新连接
+func watchReload() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	for range sig {
+		cfg, err := loadConfig(*ConfigFile)
+		if err != nil {
+			log.Println("重新加载配置失败, 继续使用原配置:", err)
+			continue
+		}
+		old := currentConfig.Swap(cfg)
+		log.Println("配置已重新加载")
+
+		reloadBackgroundMonitors(cfg)
+		applyMonitors()
+		if endpointChanged(old, cfg) {
+			log.Println("服务器地址或认证信息已变化, 重新连接")
+			closeActiveConn()
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// cpuTime /proc/stat 中一行CPU时间, 单位为 USER_HZ
+// guest 与 guest_nice 已计入 user 与 nice, 不再单独累加
+type cpuTime struct {
+	user, nice, system, idle, iowait, irq, softirq, steal uint64
+}
+
+func (t cpuTime) total() uint64 {
+	return t.user + t.nice + t.system + t.idle + t.iowait + t.irq + t.softirq + t.steal
+}
+
+// cpuStat 一次CPU时间采样, 包含总计与各核心
+type cpuStat struct {
+	all   cpuTime
+	cores []cpuTime
+}
+
+// cpuBreakdown 两次采样之间的CPU使用情况(%)
+type cpuBreakdown struct {
+	usage  float64
+	iowait float64
+	steal  float64
+	cores  []float64
+}
+
+// getCPUTimes 读取 /proc/stat 中的总计与各核心CPU时间
+func getCPUTimes() (cpuStat, error) {
+	data, err := os.ReadFile(procPath("stat"))
+	if err != nil {
+		return cpuStat{}, err
+	}
+
+	var stat cpuStat
+	found := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		t := parseCPUTime(fields[1:])
+		if fields[0] == "cpu" {
+			stat.all = t
+			found = true
+		} else {
+			stat.cores = append(stat.cores, t)
+		}
+	}
+	if !found {
+		return cpuStat{}, fmt.Errorf("CPU时间数据格式错误")
+	}
+	return stat, nil
+}
+
+// parseCPUTime 解析 user nice system idle iowait irq softirq steal, 旧内核缺少的字段记为0
+func parseCPUTime(fields []string) cpuTime {
+	var vals [8]uint64
+	for i := 0; i < len(vals) && i < len(fields); i++ {
+		vals[i], _ = strconv.ParseUint(fields[i], 10, 64)
+	}
+	return cpuTime{vals[0], vals[1], vals[2], vals[3], vals[4], vals[5], vals[6], vals[7]}
+}
+
+// cpuUsage 由两次CPU时间读数计算使用率, iowait 视为空闲
+func cpuUsage(start, end cpuTime) float64 {
+	idle := func(t cpuTime) uint64 { return t.idle + t.iowait }
+	return 100 - cpuPercent(start, end, idle)
+}
+
+// cpuPercent 计算某项CPU时间在两次读数之间所占的百分比
+func cpuPercent(start, end cpuTime, field func(cpuTime) uint64) float64 {
+	total := saturatingSub(end.total(), start.total())
+	if total == 0 {
+		return 0
+	}
+	return float64(saturatingSub(field(end), field(start))) / float64(total) * 100
+}
+
+// newCPUBreakdown 计算两次采样之间的总使用率、iowait、steal 与各核心使用率
+func newCPUBreakdown(start, end cpuStat) cpuBreakdown {
+	b := cpuBreakdown{
+		usage:  cpuUsage(start.all, end.all),
+		iowait: cpuPercent(start.all, end.all, func(t cpuTime) uint64 { return t.iowait }),
+		steal:  cpuPercent(start.all, end.all, func(t cpuTime) uint64 { return t.steal }),
+	}
+	// CPU热插拔时核心数会变化, 此时本次不计算各核心数据
+	if len(start.cores) == len(end.cores) {
+		b.cores = make([]float64, len(end.cores))
+		for i := range end.cores {
+			b.cores[i] = cpuUsage(start.cores[i], end.cores[i])
+		}
+	}
+	return b
+}
+
+// customCPU 在 custom 字段中展示 iowait、steal 与各核心使用率
+func customCPU() string {
+	sampled.RLock()
+	b := sampled.cpuDetail
+	sampled.RUnlock()
+
+	cores := make([]string, len(b.cores))
+	for i, usage := range b.cores {
+		cores[i] = fmt.Sprintf("%.0f", usage)
+	}
+	return fmt.Sprintf("CPU\\tiowait: <code>%.1f%%</code>\\tsteal: <code>%.1f%%</code>\\t核心: %s",
+		b.iowait, b.steal, strings.Join(cores, "/"))
+}
@@ -0,0 +1,26 @@
+package main
+
+import "strings"
+
+// 可通过 custom 配置附加到 custom 字段的内容, 按配置顺序显示在自定义监控数据之前
+// 服务器只保留 custom 字段的前 1023 个字节, 应按需开启
+var customSections = map[string]func() string{
+	"cpu":     customCPU,
+	"disk":    customDisk,
+	"traffic": customTraffic,
+	"probe":   customProbe,
+}
+
+// buildCustom 生成 custom 字段: 已开启的附加内容与自定义监控数据, 以 <br> 分隔
+func buildCustom(cfg *Config) string {
+	var parts []string
+	for _, name := range cfg.Custom {
+		if line := customSections[name](); line != "" {
+			parts = append(parts, line)
+		}
+	}
+	if monitors := getCustomMonitorData(); monitors != "" {
+		parts = append(parts, monitors)
+	}
+	return strings.Join(parts, "<br>")
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// patterns 返回全部通配符, 用于校验
+func (c DiskConfig) patterns() []string {
+	var all []string
+	for _, list := range [][]string{c.IncludeFstypes, c.ExcludeFstypes, c.IncludeMounts, c.ExcludeMounts} {
+		all = append(all, list...)
+	}
+	return all
+}
+
+// allowed 判断分区是否参与容量统计
+func (c DiskConfig) allowed(p disk.PartitionStat) bool {
+	fstype := strings.ToLower(p.Fstype)
+	if matchAny(c.ExcludeFstypes, fstype) || matchAny(c.ExcludeMounts, p.Mountpoint) {
+		return false
+	}
+	if len(c.IncludeMounts) > 0 && !matchAny(c.IncludeMounts, p.Mountpoint) {
+		return false
+	}
+	if len(c.IncludeFstypes) > 0 {
+		return matchAny(c.IncludeFstypes, fstype)
+	}
+	return checkValidFs(fstype)
+}
+
+// mountUsage 单个挂载点的容量(MB)与 inode 用量
+type mountUsage struct {
+	Mountpoint  string `json:"mountpoint"`
+	Device      string `json:"device"`
+	Fstype      string `json:"fstype"`
+	Total       uint64 `json:"total"`
+	Used        uint64 `json:"used"`
+	InodesTotal uint64 `json:"inodes_total"`
+	InodesUsed  uint64 `json:"inodes_used"`
+	ReadOnly    bool   `json:"readonly"`
+}
+
+func (m mountUsage) percent() float64 {
+	if m.Total == 0 {
+		return 0
+	}
+	return float64(m.Used) / float64(m.Total) * 100
+}
+
+// diskKey 挂载点去重用的键
+// 块设备的多个挂载点(如绑定挂载)只统计第一次出现的挂载点;
+// overlay、tmpfs 等不对应块设备的文件系统每次挂载都是独立的文件系统, 按设备名与挂载点区分
+func diskKey(p disk.PartitionStat) string {
+	if strings.HasPrefix(p.Device, "/") {
+		return p.Device
+	}
+	return p.Device + " " + p.Mountpoint
+}
+
+// getDisk 统计符合规则的挂载点容量(MB), 同一文件系统只统计一次, 见 diskKey
+func getDisk() (total, used uint64, mounts []mountUsage) {
+	filter := getConfig().Disk
+	diskList, err := disk.PartitionsWithContext(hostContext(), false)
+	if err != nil {
+		log.Println("读取分区列表错误:", err)
+	}
+
+	devices := make(map[string]struct{})
+	for _, p := range diskList {
+		key := diskKey(p)
+		if _, ok := devices[key]; ok || !filter.allowed(p) {
+			continue
+		}
+		usage, err := disk.Usage(rootPath(p.Mountpoint))
+		if err != nil {
+			continue
+		}
+		devices[key] = struct{}{}
+
+		m := mountUsage{
+			Mountpoint:  p.Mountpoint,
+			Device:      p.Device,
+			Fstype:      p.Fstype,
+			Total:       usage.Total / 1024.0 / 1024.0,
+			Used:        usage.Used / 1024.0 / 1024.0,
+			InodesTotal: usage.InodesTotal,
+			InodesUsed:  usage.InodesUsed,
+			ReadOnly:    contains(p.Opts, "ro"),
+		}
+		mounts = append(mounts, m)
+		total += m.Total
+		used += m.Used
+	}
+	return total, used, mounts
+}
+
+func checkValidFs(name string) bool {
+	for _, v := range ValidFs {
+		if strings.ToLower(name) == v {
+			return true
+		}
+	}
+	return false
+}
+
+// customDisk 在 custom 字段中展示各挂载点的使用率, 最满的挂载点高亮显示
+func customDisk() string {
+	sampled.RLock()
+	mounts := sampled.mounts
+	sampled.RUnlock()
+	if len(mounts) == 0 {
+		return ""
+	}
+
+	fullest := 0
+	for i, m := range mounts {
+		if m.percent() > mounts[fullest].percent() {
+			fullest = i
+		}
+	}
+
+	parts := make([]string, len(mounts))
+	for i, m := range mounts {
+		part := fmt.Sprintf("%s %.0f%%", html.EscapeString(m.Mountpoint), m.percent())
+		if m.ReadOnly {
+			part += "(ro)"
+		}
+		if i == fullest {
+			part = "<code>" + part + "</code>"
+		}
+		parts[i] = part
+	}
+	return "磁盘\\t" + strings.Join(parts, "\\t")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"log"
+	"math"
+	"sort"
+	"time"
+)
+
+// diskStat 一个设备的累计计数
+type diskStat struct {
+	reads, readBytes, readMs    uint64
+	writes, writeBytes, writeMs uint64
+	ioMs                        uint64
+}
+
+// deviceIO 单个设备在两次采样之间的平均IO情况
+type deviceIO struct {
+	Device     string  `json:"device"`
+	ReadBytes  int64   `json:"read_bytes"`  // 字节/秒
+	WriteBytes int64   `json:"write_bytes"` // 字节/秒
+	ReadIOPS   float64 `json:"read_iops"`
+	WriteIOPS  float64 `json:"write_iops"`
+	Await      float64 `json:"await"` // 每次IO平均耗时(毫秒)
+	Util       float64 `json:"util"`  // 设备忙碌时间占比(%)
+}
+
+// newDeviceIO 由两次读数计算设备的速率、IOPS、平均等待与利用率
+func newDeviceIO(dev string, prev, cur diskStat, elapsed time.Duration) deviceIO {
+	sec := elapsed.Seconds()
+	reads := saturatingSub(cur.reads, prev.reads)
+	writes := saturatingSub(cur.writes, prev.writes)
+	d := deviceIO{
+		Device:     dev,
+		ReadBytes:  int64(float64(saturatingSub(cur.readBytes, prev.readBytes)) / sec),
+		WriteBytes: int64(float64(saturatingSub(cur.writeBytes, prev.writeBytes)) / sec),
+		ReadIOPS:   float64(reads) / sec,
+		WriteIOPS:  float64(writes) / sec,
+		Util:       float64(saturatingSub(cur.ioMs, prev.ioMs)) / float64(elapsed.Milliseconds()) * 100,
+	}
+	if ios := reads + writes; ios > 0 {
+		waitMs := saturatingSub(cur.readMs, prev.readMs) + saturatingSub(cur.writeMs, prev.writeMs)
+		d.Await = float64(waitMs) / float64(ios)
+	}
+	if d.Util > 100 {
+		d.Util = 100
+	}
+	d.ReadIOPS, d.WriteIOPS = round2(d.ReadIOPS), round2(d.WriteIOPS)
+	d.Await, d.Util = round2(d.Await), round2(d.Util)
+	return d
+}
+
+// diskIOSample 磁盘IO采样, 以相邻两次读数之差除以实际经过的时间计算每秒数据
+func diskIOSample(cfg *Config) func() {
+	var prev map[string]diskStat
+	var prevTime time.Time
+
+	return func() {
+		cur, err := readDiskStats(cfg.DiskIO)
+		if err != nil {
+			log.Println("磁盘 IO 监测错误:", err)
+			return
+		}
+		now := time.Now()
+		elapsed := now.Sub(prevTime)
+		first := prev == nil
+		last := prev
+		prev, prevTime = cur, now
+		if first || elapsed < time.Millisecond {
+			return
+		}
+
+		var read, write int64
+		devices := make([]deviceIO, 0, len(cur))
+		for dev, stat := range cur {
+			before, ok := last[dev]
+			if !ok {
+				continue
+			}
+			d := newDeviceIO(dev, before, stat, elapsed)
+			read += d.ReadBytes
+			write += d.WriteBytes
+			devices = append(devices, d)
+		}
+		sort.Slice(devices, func(i, j int) bool { return devices[i].Device < devices[j].Device })
+
+		diskIO.Lock()
+		diskIO.read = read
+		diskIO.write = write
+		diskIO.devices = devices
+		diskIO.Unlock()
+	}
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,76 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// /proc/diskstats 中的扇区固定为 512 字节, 与设备实际扇区大小无关
+const diskSectorSize = 512
+
+// 默认不统计的虚拟块设备
+var diskIOVirtual = []string{"loop*", "ram*", "zram*", "nbd*"}
+
+// allowed 判断设备是否参与IO统计
+// 默认只统计整盘: 分区(如 sda1)的IO已计入整盘, 由其他设备组成的 dm/md 等设备的IO也已计入其下层磁盘;
+// 被 include 显式选中的 dm/md 等设备照常统计, 分区仍不统计
+func (c DiskIOConfig) allowed(dev string) bool {
+	if matchAny(c.Exclude, dev) {
+		return false
+	}
+	if len(c.Include) > 0 {
+		return matchAny(c.Include, dev) && isBlockDevice(dev)
+	}
+	if matchAny(diskIOVirtual, dev) {
+		return false
+	}
+	return isBlockDevice(dev) && !hasSlaves(dev)
+}
+
+// isBlockDevice 判断是否为 /sys/block 下的块设备, 分区只出现在 /sys/block/<disk>/ 下
+func isBlockDevice(dev string) bool {
+	_, err := os.Stat(sysPath("block", strings.ReplaceAll(dev, "/", "!")))
+	return err == nil
+}
+
+// hasSlaves 判断设备是否由其他块设备组成
+func hasSlaves(dev string) bool {
+	slaves, err := os.ReadDir(sysPath("block", strings.ReplaceAll(dev, "/", "!"), "slaves"))
+	return err == nil && len(slaves) > 0
+}
+
+// readDiskStats 读取 /proc/diskstats 中参与统计的设备
+func readDiskStats(filter DiskIOConfig) (map[string]diskStat, error) {
+	f, err := os.Open(procPath("diskstats"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stats := make(map[string]diskStat)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 14 || !filter.allowed(fields[2]) {
+			continue
+		}
+		var vals [11]uint64
+		for i := range vals {
+			vals[i], _ = strconv.ParseUint(fields[3+i], 10, 64)
+		}
+		stats[fields[2]] = diskStat{
+			reads:      vals[0],
+			readBytes:  vals[2] * diskSectorSize,
+			readMs:     vals[3],
+			writes:     vals[4],
+			writeBytes: vals[6] * diskSectorSize,
+			writeMs:    vals[7],
+			ioMs:       vals[9],
+		}
+	}
+	return stats, scanner.Err()
+}
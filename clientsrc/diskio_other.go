@@ -0,0 +1,38 @@
+//go:build !linux
+
+package main
+
+import "github.com/shirou/gopsutil/v3/disk"
+
+// allowed 判断设备是否参与IO统计, 非 Linux 系统只按 include/exclude 过滤
+func (c DiskIOConfig) allowed(dev string) bool {
+	if matchAny(c.Exclude, dev) {
+		return false
+	}
+	return len(c.Include) == 0 || matchAny(c.Include, dev)
+}
+
+// readDiskStats 由 gopsutil 读取参与统计的设备
+func readDiskStats(filter DiskIOConfig) (map[string]diskStat, error) {
+	counters, err := disk.IOCounters()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]diskStat)
+	for dev, c := range counters {
+		if !filter.allowed(dev) {
+			continue
+		}
+		stats[dev] = diskStat{
+			reads:      c.ReadCount,
+			readBytes:  c.ReadBytes,
+			readMs:     c.ReadTime,
+			writes:     c.WriteCount,
+			writeBytes: c.WriteBytes,
+			writeMs:    c.WriteTime,
+			ioMs:       c.IoTime,
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/shirou/gopsutil/v3/common"
+)
+
+const defaultProcfs = "/proc"
+
+// procfs 返回 procfs 挂载点, 未设置时为 rootfs 下的 proc
+func (cfg *Config) procfs() string {
+	if cfg.Procfs != "" {
+		return cfg.Procfs
+	}
+	return filepath.Join(cfg.Rootfs, "proc")
+}
+
+// sysfs 返回 sysfs 挂载点, 未设置时为 rootfs 下的 sys
+func (cfg *Config) sysfs() string {
+	if cfg.Sysfs != "" {
+		return cfg.Sysfs
+	}
+	return filepath.Join(cfg.Rootfs, "sys")
+}
+
+// hostKey 返回宿主机文件系统设置的指纹, 变化时需重建采样基线
+func (cfg *Config) hostKey() string {
+	return cfg.Rootfs + "|" + cfg.procfs() + "|" + cfg.sysfs()
+}
+
+// procPath 返回 procfs 下的路径
+func procPath(elem ...string) string {
+	return filepath.Join(append([]string{getConfig().procfs()}, elem...)...)
+}
+
+// procNetPath 返回 procfs 下 net 目录中的文件
+// 使用挂载进容器的宿主机 procfs 时, net 指向的是当前进程所在的网络命名空间,
+// 因此改为读取宿主机 1 号进程的 net 目录
+func procNetPath(elem ...string) string {
+	if getConfig().procfs() == defaultProcfs {
+		return procPath(append([]string{"net"}, elem...)...)
+	}
+	return procPath(append([]string{"1", "net"}, elem...)...)
+}
+
+// sysPath 返回 sysfs 下的路径
+func sysPath(elem ...string) string {
+	return filepath.Join(append([]string{getConfig().sysfs()}, elem...)...)
+}
+
+// rootPath 返回宿主机根文件系统中的路径, 用于访问 mountinfo 中列出的挂载点
+func rootPath(elem ...string) string {
+	return filepath.Join(append([]string{getConfig().Rootfs}, elem...)...)
+}
+
+// hostContext 返回携带 procfs/sysfs/rootfs 设置的 context, 供 gopsutil 调用使用
+func hostContext() context.Context {
+	cfg := getConfig()
+	return context.WithValue(context.Background(), common.EnvKey, common.EnvMap{
+		common.HostProcEnvKey: cfg.procfs(),
+		common.HostSysEnvKey:  cfg.sysfs(),
+		common.HostRootEnvKey: cfg.Rootfs,
+		common.HostDevEnvKey:  filepath.Join(cfg.Rootfs, "dev"),
+		common.HostEtcEnvKey:  filepath.Join(cfg.Rootfs, "etc"),
+	})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 未配置 http.status 时视为正常的状态码
+var defaultHTTPStatus = []string{"200", "204", "301", "302", "401"}
+
+// validate 校验检查选项
+func (o MonitorOptions) validate() error {
+	if o.HTTP != nil {
+		if err := o.HTTP.validate(); err != nil {
+			return err
+		}
+	}
+	if o.TLS != nil {
+		return o.TLS.validate()
+	}
+	return nil
+}
+
+// validate 校验 http 检查选项
+func (h *HTTPCheck) validate() error {
+	if h.Method != "" && strings.ContainsAny(h.Method, " \t\r\n") {
+		return fmt.Errorf("请求方法 %q 无效", h.Method)
+	}
+	for _, pattern := range h.Status {
+		if _, _, err := parseStatusRange(pattern); err != nil {
+			return err
+		}
+	}
+	if h.MatchRegex {
+		if _, err := regexp.Compile(h.Match); err != nil {
+			return fmt.Errorf("正文匹配规则 %q 无效: %w", h.Match, err)
+		}
+	}
+	if h.MaxSize < 0 {
+		return fmt.Errorf("响应大小上限不能为负数")
+	}
+	return nil
+}
+
+// parseStatusRange 解析状态码规则, 支持 "200"、"2xx" 与 "200-399"
+func parseStatusRange(pattern string) (int, int, error) {
+	p := strings.ToLower(strings.TrimSpace(pattern))
+	if len(p) == 3 && strings.HasSuffix(p, "xx") && p[0] >= '1' && p[0] <= '5' {
+		low := int(p[0]-'0') * 100
+		return low, low + 99, nil
+	}
+	lowStr, highStr, isRange := strings.Cut(p, "-")
+	low, err := strconv.Atoi(lowStr)
+	high := low
+	if err == nil && isRange {
+		high, err = strconv.Atoi(highStr)
+	}
+	if err != nil || low < 100 || high > 599 || low > high {
+		return 0, 0, fmt.Errorf("状态码规则 %q 无效", pattern)
+	}
+	return low, high, nil
+}
+
+// method 返回请求方法
+func (h *HTTPCheck) method() string {
+	if h.Method == "" {
+		return http.MethodGet
+	}
+	return strings.ToUpper(h.Method)
+}
+
+// newRequestBody 返回请求正文, 未设置时为 nil
+func (h *HTTPCheck) newRequestBody() io.Reader {
+	if h.Body == "" {
+		return nil
+	}
+	return strings.NewReader(h.Body)
+}
+
+// setHeaders 设置请求头, Host 头用于覆盖请求的主机名
+func (h *HTTPCheck) setHeaders(req *http.Request) {
+	for key, value := range h.Headers {
+		if strings.EqualFold(key, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(key, value)
+	}
+}
+
+// checkStatus 判断状态码是否符合规则
+func (h *HTTPCheck) checkStatus(code int) error {
+	patterns := h.Status
+	if len(patterns) == 0 {
+		patterns = defaultHTTPStatus
+	}
+	for _, pattern := range patterns {
+		low, high, err := parseStatusRange(pattern)
+		if err == nil && code >= low && code <= high {
+			return nil
+		}
+	}
+	return fmt.Errorf("状态码 %d", code)
+}
+
+// readBody 读取响应正文并按规则检查
+// 未设置匹配规则时只读取并丢弃正文, 用于计算下载耗时
+func (h *HTTPCheck) readBody(body io.Reader) error {
+	if h.MaxSize > 0 {
+		body = io.LimitReader(body, h.MaxSize+1)
+	}
+	if h.Match == "" {
+		n, err := io.Copy(io.Discard, body)
+		if err != nil {
+			return fmt.Errorf("读取响应失败: %w", err)
+		}
+		return h.checkSize(n)
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("读取响应失败: %w", err)
+	}
+	if err := h.checkSize(int64(len(data))); err != nil {
+		return err
+	}
+	var found bool
+	if h.MatchRegex {
+		re, err := regexp.Compile(h.Match)
+		if err != nil {
+			return err
+		}
+		found = re.Match(data)
+	} else {
+		found = bytes.Contains(data, []byte(h.Match))
+	}
+	switch {
+	case found && h.MatchAbsent:
+		return fmt.Errorf("正文包含 %q", h.Match)
+	case !found && !h.MatchAbsent:
+		return fmt.Errorf("正文未包含 %q", h.Match)
+	}
+	return nil
+}
+
+// checkSize 判断正文是否超过大小上限
+func (h *HTTPCheck) checkSize(n int64) error {
+	if h.MaxSize > 0 && n > h.MaxSize {
+		return fmt.Errorf("响应超过 %d 字节", h.MaxSize)
+	}
+	return nil
+}
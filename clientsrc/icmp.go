@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ICMP 回显报文类型
+const (
+	icmpv4EchoRequest = 8
+	icmpv4EchoReply   = 0
+	icmpv6EchoRequest = 128
+	icmpv6EchoReply   = 129
+)
+
+var errProbeTimeout = errors.New("探测超时")
+
+// icmpPinger 一个目标的 ICMP 回显探测
+// 优先使用无需特权的 ICMP 数据报套接字(受 net.ipv4.ping_group_range 限制), 不可用时使用原始套接字
+type icmpPinger struct {
+	conn     net.PacketConn
+	ipv6     bool
+	datagram bool   // 数据报套接字由内核改写标识符并只投递属于本套接字的回复
+	id       uint16 // 原始套接字下用于区分其他进程的回复
+	seq      uint16
+	token    [8]byte // 附在载荷中, 用于丢弃不属于本探测的回复
+}
+
+// newICMPPinger 按地址族打开 ICMP 套接字
+func newICMPPinger(ipv6 bool) (*icmpPinger, error) {
+	p := &icmpPinger{ipv6: ipv6}
+	if _, err := rand.Read(p.token[:]); err != nil {
+		return nil, err
+	}
+	p.id = binary.BigEndian.Uint16(p.token[:2])
+
+	conn, err := listenICMPDatagram(ipv6)
+	if err == nil {
+		p.conn, p.datagram = conn, true
+		return p, nil
+	}
+	network, addr := "ip4:icmp", "0.0.0.0"
+	if ipv6 {
+		network, addr = "ip6:ipv6-icmp", "::"
+	}
+	conn, rawErr := net.ListenPacket(network, addr)
+	if rawErr != nil {
+		return nil, fmt.Errorf("无法打开 ICMP 套接字, 请调整 net.ipv4.ping_group_range 或授予 CAP_NET_RAW, 非 Linux 系统需以管理员运行: %v; %v", err, rawErr)
+	}
+	p.conn = conn
+	return p, nil
+}
+
+// ping 发送一个回显请求并等待序号相同的回复, 超时返回 errProbeTimeout
+func (p *icmpPinger) ping(ip net.IP, timeout time.Duration) (time.Duration, error) {
+	p.seq++
+	seq := p.seq
+
+	msg := make([]byte, 8+len(p.token))
+	msg[0] = icmpv4EchoRequest
+	if p.ipv6 {
+		msg[0] = icmpv6EchoRequest
+	}
+	binary.BigEndian.PutUint16(msg[4:], p.id)
+	binary.BigEndian.PutUint16(msg[6:], seq)
+	copy(msg[8:], p.token[:])
+	if !p.ipv6 {
+		// ICMPv6 的校验和包含伪首部, 由内核计算
+		binary.BigEndian.PutUint16(msg[2:], icmpChecksum(msg))
+	}
+
+	var dst net.Addr = &net.IPAddr{IP: ip}
+	if p.datagram {
+		dst = &net.UDPAddr{IP: ip}
+	}
+	start := time.Now()
+	deadline := start.Add(timeout)
+	if err := p.conn.SetDeadline(deadline); err != nil {
+		return 0, err
+	}
+	if _, err := p.conn.WriteTo(msg, dst); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := p.conn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return 0, errProbeTimeout
+			}
+			return 0, err
+		}
+		if p.isReply(buf[:n], from, ip, seq) {
+			return time.Since(start), nil
+		}
+	}
+}
+
+// isReply 判断收到的报文是否为本次请求的回复, 迟到的旧序号回复会被丢弃
+func (p *icmpPinger) isReply(b []byte, from net.Addr, ip net.IP, seq uint16) bool {
+	if len(b) < 8+len(p.token) {
+		return false
+	}
+	reply := byte(icmpv4EchoReply)
+	if p.ipv6 {
+		reply = icmpv6EchoReply
+	}
+	if b[0] != reply || binary.BigEndian.Uint16(b[6:]) != seq || string(b[8:8+len(p.token)]) != string(p.token[:]) {
+		return false
+	}
+	if !p.datagram && binary.BigEndian.Uint16(b[4:]) != p.id {
+		return false
+	}
+	switch addr := from.(type) {
+	case *net.UDPAddr:
+		return addr.IP.Equal(ip)
+	case *net.IPAddr:
+		return addr.IP.Equal(ip)
+	}
+	return false
+}
+
+func (p *icmpPinger) Close() error {
+	return p.conn.Close()
+}
+
+// icmpChecksum 计算 ICMPv4 校验和
+func icmpChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// listenICMPDatagram 仅 Linux 支持 ICMP 数据报套接字, 其他系统直接使用原始套接字
+func listenICMPDatagram(ipv6 bool) (net.PacketConn, error) {
+	return nil, errors.New("当前系统不支持 ICMP 数据报套接字")
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// 流量上报方式
+const (
+	trafficModeTotal = "total" // 上报累计流量
+	trafficModeCycle = "cycle" // 上报当前账期的流量
+)
+
+// 各类账本保留的条目数
+const (
+	ledgerKeepDays   = 62
+	ledgerKeepMonths = 24
+	ledgerKeepCycles = 24
+)
+
+// trafficBucket 一个统计周期内的流量(字节), Start 为周期开始日期
+type trafficBucket struct {
+	Start string `json:"start"`
+	Rx    uint64 `json:"rx"`
+	Tx    uint64 `json:"tx"`
+}
+
+// trafficLedger 按日、自然月与账期记录的流量, 随状态文件保存
+type trafficLedger struct {
+	Days   []trafficBucket `json:"days"`
+	Months []trafficBucket `json:"months"`
+	Cycles []trafficBucket `json:"cycles"`
+}
+
+// trafficUsage 当日、当月与当前账期的流量, 以及账期流量占配额的比例
+type trafficUsage struct {
+	Day       trafficBucket `json:"day"`
+	Month     trafficBucket `json:"month"`
+	Cycle     trafficBucket `json:"cycle"`
+	Quota     uint64        `json:"quota,omitempty"`      // 字节
+	QuotaUsed float64       `json:"quota_used,omitempty"` // %
+}
+
+// cycleStart 返回 t 所在账期的开始日期, 账期从每月的 resetDay 日 0 点开始
+func cycleStart(t time.Time, resetDay int) time.Time {
+	start := time.Date(t.Year(), t.Month(), resetDay, 0, 0, 0, 0, t.Location())
+	if t.Day() < resetDay {
+		start = start.AddDate(0, -1, 0)
+	}
+	return start
+}
+
+// add 将新增流量计入 t 所在的日、月与账期
+func (l *trafficLedger) add(t time.Time, resetDay int, rx, tx uint64) {
+	l.Days = addBucket(l.Days, t.Format("2006-01-02"), rx, tx, ledgerKeepDays)
+	l.Months = addBucket(l.Months, t.Format("2006-01"), rx, tx, ledgerKeepMonths)
+
+	cycle := cycleStart(t, resetDay).Format("2006-01-02")
+	if n := len(l.Cycles); n > 0 && l.Cycles[n-1].Start == cycle {
+		l.Cycles[n-1].Rx += rx
+		l.Cycles[n-1].Tx += tx
+		return
+	}
+	// 进入新账期, 或修改了重置日: 去掉与新账期重叠的条目, 以日账本补齐账期开始以来的流量
+	for len(l.Cycles) > 0 && l.Cycles[len(l.Cycles)-1].Start >= cycle {
+		l.Cycles = l.Cycles[:len(l.Cycles)-1]
+	}
+	bucket := trafficBucket{Start: cycle}
+	for _, day := range l.Days {
+		if day.Start >= cycle {
+			bucket.Rx += day.Rx
+			bucket.Tx += day.Tx
+		}
+	}
+	l.Cycles = append(l.Cycles, bucket)
+	if len(l.Cycles) > ledgerKeepCycles {
+		l.Cycles = l.Cycles[len(l.Cycles)-ledgerKeepCycles:]
+	}
+}
+
+// addBucket 将流量计入 start 对应的条目, 必要时新建条目并丢弃最旧的条目
+func addBucket(buckets []trafficBucket, start string, rx, tx uint64, keep int) []trafficBucket {
+	if n := len(buckets); n > 0 && buckets[n-1].Start == start {
+		buckets[n-1].Rx += rx
+		buckets[n-1].Tx += tx
+		return buckets
+	}
+	buckets = append(buckets, trafficBucket{Start: start, Rx: rx, Tx: tx})
+	if len(buckets) > keep {
+		buckets = buckets[len(buckets)-keep:]
+	}
+	return buckets
+}
+
+// usage 返回 t 所在的日、月与账期的流量, 没有记录的周期流量为0
+func (l *trafficLedger) usage(t time.Time, cfg TrafficConfig) trafficUsage {
+	u := trafficUsage{
+		Day:   lastBucket(l.Days, t.Format("2006-01-02")),
+		Month: lastBucket(l.Months, t.Format("2006-01")),
+		Cycle: lastBucket(l.Cycles, cycleStart(t, cfg.ResetDay).Format("2006-01-02")),
+	}
+	if cfg.Quota > 0 {
+		u.Quota = uint64(cfg.Quota * 1024 * 1024 * 1024)
+		u.QuotaUsed = round2(float64(cfg.quotaBytes(u.Cycle)) / float64(u.Quota) * 100)
+	}
+	return u
+}
+
+func lastBucket(buckets []trafficBucket, start string) trafficBucket {
+	if n := len(buckets); n > 0 && buckets[n-1].Start == start {
+		return buckets[n-1]
+	}
+	return trafficBucket{Start: start}
+}
+
+// quotaBytes 按配额计算方式返回计入配额的流量
+func (c TrafficConfig) quotaBytes(b trafficBucket) uint64 {
+	switch c.QuotaDirection {
+	case "in":
+		return b.Rx
+	case "out":
+		return b.Tx
+	case "max":
+		return max(b.Rx, b.Tx)
+	default:
+		return b.Rx + b.Tx
+	}
+}
+
+// customTraffic 在 custom 字段中展示当前账期的流量与配额使用比例
+func customTraffic() string {
+	sampled.RLock()
+	u := sampled.traffic
+	sampled.RUnlock()
+	if u == nil {
+		return ""
+	}
+
+	line := fmt.Sprintf("流量\\t本期(%s起): 入 %s 出 %s", u.Cycle.Start, formatBytes(u.Cycle.Rx), formatBytes(u.Cycle.Tx))
+	if u.Quota > 0 {
+		line += fmt.Sprintf("\\t已用配额: <code>%.1f%%</code> / %s", u.QuotaUsed, formatBytes(u.Quota))
+	}
+	return line
+}
+
+// formatBytes 以 1024 进制格式化字节数
+func formatBytes(b uint64) string {
+	const units = "KMGTPE"
+	if b < 1024 {
+		return fmt.Sprintf("%dB", b)
+	}
+	v := float64(b) / 1024
+	i := 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.2f%ciB", v, units[i])
+}
@@ -1,28 +1,24 @@
 package main
 
 import (
-	"bufio"
-	"crypto/tls"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"net"
-	"net/http"
 	"os"
-	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
-	"unsafe"
 
 	jsoniter "github.com/json-iterator/go"
-	"github.com/shirou/gopsutil/v3/disk"
 )
 
 var (
+	ConfigFile             = flag.String("config", "", "配置文件路径(JSON), 收到 SIGHUP 时重新加载")
 	Server                 = flag.String("host", "", "主机地址")
 	Port                   = flag.Int("port", 35601, "主机端口")
 	User                   = flag.String("user", "", "客户端用户名")
@@ -34,55 +30,81 @@ var (
 	CT                     = flag.String("ct", "ct.tz.cloudcpp.com", "CT 探针地址")
 	CM                     = flag.String("cm", "cm.tz.cloudcpp.com", "CM 探针地址")
 	ProbePort              = flag.Int("probePort", 80, "探针端口")
-	CachedFs               = make(map[string]struct{})
+	Rootfs                 = flag.String("rootfs", "/", "宿主机根文件系统挂载点, 容器内监控宿主机时使用")
+	Procfs                 = flag.String("procfs", "", "procfs 挂载点(默认为 rootfs 下的 proc)")
+	Sysfs                  = flag.String("sysfs", "", "sysfs 挂载点(默认为 rootfs 下的 sys)")
+	CustomSections         = flag.String("custom", "", "附加到 custom 字段的内容, 逗号分隔, 可选: cpu, disk, traffic, probe")
+	TrafficState           = flag.String("trafficState", "", "流量状态文件, 设置后上报跨重启累计的流量")
+	TrafficMode            = flag.String("trafficMode", "total", "流量上报方式: total 累计流量 / cycle 当前账期流量")
+	VnstatIfaces           = flag.String("vnstatIface", "", "vnstat 统计的网卡, 逗号分隔, 默认按网卡过滤规则选择")
+	VnstatWindow           = flag.String("vnstatWindow", "month", "vnstat 统计窗口: today / month / cycle")
+	ResetDay               = flag.Int("resetDay", 1, "账期重置日(1-28)")
+	TrafficQuota           = flag.Float64("trafficQuota", 0, "每个账期的流量配额(GiB), 0 表示不限")
+	MemoryMode             = flag.String("memoryMode", memoryModeLegacy, "内存用量计算方式(legacy或available)")
+	ZfsArc                 = flag.Bool("zfsArc", false, "从已用内存中扣除 ZFS ARC")
+	Container              = flag.Bool("container", false, "容器模式, 按 cgroup 限制上报内存与CPU")
+	Extended               = flag.Bool("extended", false, "在 extended 字段中上报扩展数据")
+	ExtendedFile           = flag.String("extendedFile", "", "扩展数据写入的文件, 设置后扩展数据不随 update 发送")
 	ProbeProtocolPrefer    = flag.String("proto", "ipv4", "探针协议偏好(ipv4或ipv6)")
+	ProbeType              = flag.String("probeType", probeTypeTCP, "探测方式(tcp或icmp)")
+	ProbeTimeout           = flag.Float64("probeTimeout", defaultProbeTimeout, "探测超时(秒), 超时计为丢包")
 	ValidFs                = []string{"ext4", "ext3", "ext2", "reiserfs", "jfs", "btrfs", "fuseblk", "zfs", "simfs", "ntfs", "fat32", "exfat", "xfs", "apfs"}
 	PingPacketHistoryLen   = 64
 	OnlinePacketHistoryLen = 64
-	timeCU, timeCT, timeCM int
-	pingCU, pingCM, pingCT float64
+	virtRegex              = regexp.MustCompile(`lo|tun|docker|veth|br-|vmbr|vnet|kube`)
 )
 
-var json = jsoniter.ConfigCompatibleWithStandardLibrary
+// 不转义 HTML 字符: custom 中的 <br> 等标签转义后长度翻倍, 容易超出服务器的行缓冲
+// 服务器解析 JSON 后原样输出 custom, 转义本就不能防止注入; 写入 custom 的外部文本需自行 html.EscapeString
+var json = jsoniter.Config{
+	EscapeHTML:             false,
+	SortMapKeys:            true,
+	ValidateJsonRawMessage: true,
+}.Froze()
 
 // 全局状态存储（带并发保护）
 var (
-	lostRate = sync.Map{} // key: mark(string), value: float64(%)
-	pingTime = sync.Map{} // key: mark(string), value: int(ms)
-	netSpeed = struct {
+	probeStats = sync.Map{} // key: 探测目标名称(string), value: probeStat
+	netSpeed   = struct {
 		sync.Mutex
-		netrx int64
-		nettx int64
-		clock float64
-		diff  float64
-		avgrx int64
-		avgtx int64
+		netrx  int64
+		nettx  int64
+		clock  float64
+		diff   float64
+		avgrx  int64
+		avgtx  int64
+		ifaces []interfaceStat
 	}{}
 	diskIO = struct {
 		sync.Mutex
-		read  int64
-		write int64
+		read    int64 // 字节/秒
+		write   int64 // 字节/秒
+		devices []deviceIO
 	}{}
-	monitorServer = struct {
+	// 各采样线程的最新结果, 发送时只读取快照
+	sampled = struct {
 		sync.RWMutex
-		servers map[string]*MonitorServer
-	}{
-		servers: make(map[string]*MonitorServer),
-	}
+		cpu                  float64
+		cpuDetail            cpuBreakdown
+		uptime               uint64
+		memTotal, memUsed    uint64
+		swapTotal, swapFree  uint64
+		memDetail            memoryDetail
+		hddTotal, hddUsed    uint64
+		mounts               []mountUsage
+		load1, load5, load15 float64
+		tcp, udp             int
+		process, thread      int
+		tcpStates            map[string]int
+		netIn, netOut        uint64
+		traffic              *trafficUsage
+		online4, online6     bool
+		online               *onlineHealth
+	}{}
+	// 重新连接后立即触发一次在线检查
+	onlineTrigger = make(chan struct{}, 1)
 )
 
-// MonitorServer 自定义服务器监控数据
-type MonitorServer struct {
-	Type         string  `json:"type"`
-	DnsTime      int     `json:"dns_time"`
-	ConnectTime  int     `json:"connect_time"`
-	DownloadTime int     `json:"download_time"`
-	OnlineRate   float64 `json:"online_rate"`
-	host         string
-	interval     int
-	stop         chan struct{}
-}
-
 // ServerStatus 完整状态数据结构
 type ServerStatus struct {
 	Uptime      uint64          `json:"uptime"`
@@ -100,8 +122,8 @@ type ServerStatus struct {
 	NetworkTx   int64           `json:"network_tx"`
 	NetworkIn   uint64          `json:"network_in"`
 	NetworkOut  uint64          `json:"network_out"`
-	Online4     bool            `json:"online4,omitempty"`
-	Online6     bool            `json:"online6,omitempty"`
+	Online4     bool            `json:"online4"`
+	Online6     bool            `json:"online6"`
 	PingCU      float64         `json:"ping_10010"`
 	PingCM      float64         `json:"ping_10086"`
 	PingCT      float64         `json:"ping_189"`
@@ -115,15 +137,42 @@ type ServerStatus struct {
 	IoRead      int64           `json:"io_read"`
 	IoWrite     int64           `json:"io_write"`
 	Custom      string          `json:"custom"`
+	Extended    *ExtendedStatus `json:"extended,omitempty"`
+}
+
+// ExtendedStatus 扩展数据, 服务器不识别, 供自定义面板或日志使用
+// 仅在开启 extended 时上报
+type ExtendedStatus struct {
+	TCPStates  map[string]int  `json:"tcp_states,omitempty"`
+	CPU        *ExtendedCPU    `json:"cpu,omitempty"`
+	Memory     *ExtendedMemory `json:"memory,omitempty"`
+	Disks      []mountUsage    `json:"disks,omitempty"`
+	DiskIO     []deviceIO      `json:"disk_io,omitempty"`
+	Interfaces []interfaceStat `json:"interfaces,omitempty"`
+	Traffic    *trafficUsage   `json:"traffic,omitempty"`
+	Probes     []probeResult   `json:"probes,omitempty"`
+	Online     *onlineHealth   `json:"online,omitempty"`
+	Monitors   []monitorResult `json:"monitors,omitempty"`
+}
+
+// ExtendedCPU CPU使用率明细(%)
+type ExtendedCPU struct {
+	IOWait jsoniter.Number   `json:"iowait"`
+	Steal  jsoniter.Number   `json:"steal"`
+	Cores  []jsoniter.Number `json:"cores"`
 }
 
 func main() {
 	flag.Parse()
-	parseDSN()
-	validateParams()
+	cfg, err := loadConfig(*ConfigFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	currentConfig.Store(cfg)
 
 	// 启动所有监控线程
-	startBackgroundMonitors()
+	startBackgroundMonitors(cfg)
+	go watchReload()
 
 	// 主连接循环
 	for {
@@ -132,651 +181,580 @@ func main() {
 	}
 }
 
-// 解析DSN参数
-func parseDSN() {
-	if *DSN != "" {
-		parts := strings.Split(*DSN, "@")
-		if len(parts) != 2 {
-			log.Fatal("DSN 格式错误, 缺少 @ 符号, 应为 username:password@host:port")
-		}
-		auth := strings.Split(parts[0], ":")
-		if len(auth) != 2 {
-			log.Fatal("DSN 格式错误, 缺少 : 号符, 应为 username:password@host:port")
-		}
-		*User = auth[0]
-		*Password = auth[1]
-
-		addr := strings.Split(parts[1], ":")
-		*Server = addr[0]
-		if len(addr) == 2 {
-			port, err := strconv.Atoi(addr[1])
-			if err == nil {
-				*Port = port
+// 后台监控线程组, 按配置中的周期各自采样
+var backgroundMonitors = []*backgroundMonitor{
+	{
+		// 多目标Ping监测
+		name: "ping",
+		key: func(cfg *Config) string {
+			return fmt.Sprint(cfg.period("ping"), cfg.Probe)
+		},
+		run: func(ctx context.Context, cfg *Config) {
+			for _, target := range cfg.Probe.Targets {
+				go pingWorker(ctx, target, target.period(cfg.period("ping")))
 			}
-		}
-	}
-}
-
-// 验证参数有效性
-func validateParams() {
-	if *Port < 1 || *Port > 65535 {
-		log.Fatal("端口号必须在1到65535之间")
-	}
-	if *Server == "" || *User == "" || *Password == "" {
-		log.Fatal("主机地址、用户名和密码不能为空")
-	}
-	probeProtocolPrefer := strings.ToLower(*ProbeProtocolPrefer)
-	switch probeProtocolPrefer {
-	case "ipv4":
-		*ProbeProtocolPrefer = "ip4"
-	case "ipv6":
-		*ProbeProtocolPrefer = "ip6"
-	default:
-		*ProbeProtocolPrefer = "ip"
-	}
-}
-
-// 启动所有后台监控线程
-func startBackgroundMonitors() {
-	// 启动多目标Ping监测
-	go pingWorker(*CU, "CU", *ProbePort)
-	go pingWorker(*CT, "CT", *ProbePort)
-	go pingWorker(*CM, "CM", *ProbePort)
-
-	// 启动网络速率监测
-	go netSpeedMonitor()
-
-	// 启动磁盘IO监测
-	go diskIOMonitor()
-}
-
-// pingWorker 多目标Ping监测工作线程
-func pingWorker(host, mark string, port int) {
-	lostCount := 0
-	history := make([]int, 0, PingPacketHistoryLen)
-	userInterval := time.Duration(*Interval) * time.Second
-	interval := userInterval // 初始间隔
-
-	for {
-		// 解析IP（优先指定协议）
-		ip, err := resolveIP(host)
-		if err != nil {
-			log.Printf("PingWorker %s: 解析IP失败: %v\n", mark, err)
-			ip = host // 解析失败直接使用主机名
-		}
-
-		// 维护历史队列
-		if len(history) >= PingPacketHistoryLen {
-			if history[0] == 0 {
-				lostCount--
+		},
+	},
+	{
+		// 网络速率监测
+		name: "netspeed",
+		key: func(cfg *Config) string {
+			return fmt.Sprint(cfg.period("netspeed"), cfg.hostKey(), cfg.Interfaces)
+		},
+		run: func(ctx context.Context, cfg *Config) {
+			go runEvery(ctx, cfg.period("netspeed"), netSpeedSample())
+		},
+	},
+	{
+		// 磁盘IO监测
+		name: "diskio",
+		key: func(cfg *Config) string {
+			return fmt.Sprint(cfg.period("diskio"), cfg.hostKey(), cfg.DiskIO)
+		},
+		run: func(ctx context.Context, cfg *Config) {
+			go runEvery(ctx, cfg.period("diskio"), diskIOSample(cfg))
+		},
+	},
+	{
+		// CPU使用率采样
+		name: "cpu",
+		key: func(cfg *Config) string {
+			return fmt.Sprint(cfg.period("cpu"), cfg.hostKey(), cfg.Container)
+		},
+		run: func(ctx context.Context, cfg *Config) {
+			go runEvery(ctx, cfg.period("cpu"), cpuSample(cfg))
+		},
+	},
+	{
+		// 内存与交换分区采样
+		name: "memory",
+		key: func(cfg *Config) string {
+			return fmt.Sprint(cfg.period("memory"))
+		},
+		run: func(ctx context.Context, cfg *Config) {
+			go runEvery(ctx, cfg.period("memory"), memorySample)
+		},
+	},
+	{
+		// 负载与运行时间采样
+		name: "load",
+		key: func(cfg *Config) string {
+			return fmt.Sprint(cfg.period("load"))
+		},
+		run: func(ctx context.Context, cfg *Config) {
+			go runEvery(ctx, cfg.period("load"), loadSample)
+		},
+	},
+	{
+		// 磁盘容量采样
+		name: "disk",
+		key: func(cfg *Config) string {
+			return fmt.Sprint(cfg.period("disk"))
+		},
+		run: func(ctx context.Context, cfg *Config) {
+			go runEvery(ctx, cfg.period("disk"), diskSample)
+		},
+	},
+	{
+		// 连接数与进程数采样
+		name: "process",
+		key: func(cfg *Config) string {
+			return fmt.Sprint(cfg.period("process"))
+		},
+		run: func(ctx context.Context, cfg *Config) {
+			go runEvery(ctx, cfg.period("process"), processSample)
+		},
+	},
+	{
+		// 累计流量采样
+		name: "traffic",
+		key: func(cfg *Config) string {
+			return fmt.Sprint(cfg.period("traffic"), cfg.Vnstat, cfg.Interfaces, cfg.Traffic)
+		},
+		run: func(ctx context.Context, cfg *Config) {
+			if !cfg.Vnstat && cfg.Traffic.StateFile != "" {
+				go runEvery(ctx, cfg.period("traffic"), persistentTrafficSample(cfg))
+				return
 			}
-			interval = userInterval * 60 // 每次检查后增加间隔
-			history = history[1:]
-		}
-
-		// 执行连接测试
-		start := time.Now()
-		conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, strconv.Itoa(port)), time.Second)
-		if err != nil {
-			lostCount++
-			history = append(history, 0)
-			pingTime.Store(mark, 0) // 超时记为0
-		} else {
-			conn.Close()
-			delay := int(time.Since(start).Milliseconds())
-			pingTime.Store(mark, delay)
-			history = append(history, 1)
-		}
-
-		// 计算丢包率
-		if len(history) > PingPacketHistoryLen/2 {
-			rate := float64(lostCount) / float64(len(history)) * 100
-			lostRate.Store(mark, rate)
-		}
-		time.Sleep(interval)
-	}
-}
-
-// resolveIP 根据协议偏好解析IP
-func resolveIP(host string) (string, error) {
-	if strings.Contains(host, ":") {
-		return host, nil // 已为IPv6地址
-	}
-
-	prefer := strings.ToLower(*ProbeProtocolPrefer)
-	ipAddr, err := net.ResolveIPAddr(prefer, host)
-	if err != nil {
-		return "", err
-	}
-	return ipAddr.IP.String(), nil
+			go runEvery(ctx, cfg.period("traffic"), trafficSample(cfg))
+		},
+	},
+	{
+		// 在线状态检查
+		name: "online",
+		key: func(cfg *Config) string {
+			return fmt.Sprint(cfg.period("online"), cfg.Online)
+		},
+		run: func(ctx context.Context, cfg *Config) { go onlineMonitor(ctx, cfg) },
+	},
 }
 
-// netSpeedMonitor 网络速率监测
-func netSpeedMonitor() {
-	interval := time.Duration(*Interval) * time.Second
-	netSpeed.avgrx = 0
-	netSpeed.avgtx = 0
-	netSpeed.clock = float64(time.Now().UnixNano()) / 1e9
+// netSpeedSample 网络速率采样, 以相邻两次读数之差除以实际经过的时间计算
+// 启动或重新加载配置后的第一次读数只作为基准, 不计算速率, 此前的速率保持不变
+func netSpeedSample() func() {
+	first := true
 
-	for {
-		avgrx, avgtx, err := getNetBytes()
+	return func() {
+		ifaces, err := getInterfaces()
 		if err != nil {
 			log.Println("网络速率监测错误:", err)
-			time.Sleep(interval)
-			continue
+			return
+		}
+		var avgrx, avgtx int64
+		for _, iface := range ifaces {
+			avgrx += iface.RxBytes
+			avgtx += iface.TxBytes
 		}
 
 		now := float64(time.Now().UnixNano()) / 1e9
 		netSpeed.Lock()
 		netSpeed.diff = now - netSpeed.clock
-		if netSpeed.diff > 0 {
+		if !first && netSpeed.diff > 0 {
 			netSpeed.netrx = int64(float64(avgrx-netSpeed.avgrx) / netSpeed.diff)
 			netSpeed.nettx = int64(float64(avgtx-netSpeed.avgtx) / netSpeed.diff)
 		}
 		netSpeed.clock = now
 		netSpeed.avgrx = avgrx
 		netSpeed.avgtx = avgtx
+		netSpeed.ifaces = ifaces
 		netSpeed.Unlock()
-
-		time.Sleep(interval)
+		first = false
 	}
 }
 
-// getNetBytes 获取非虚拟网卡的累计字节数
-func getNetBytes() (rx, tx int64, err error) {
-	file, err := os.Open("/proc/net/dev")
+// cpuSample CPU使用率采样, 以相邻两次 /proc/stat 读数计算
+// 容器模式下若设置了 CPU 配额, 则改为按 cgroup 的用量与配额计算
+func cpuSample(cfg *Config) func() {
+	var container func() (float64, bool)
+	if cfg.Container {
+		container, _ = cgroupCPUSample()
+	}
+	prev, err := getCPUTimes()
 	if err != nil {
-		return 0, 0, err
+		log.Println("CPU 监测错误:", err)
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	// 跳过前两行标题
-	scanner.Scan()
-	scanner.Scan()
-
-	virtRegex := regexp.MustCompile(`lo|tun|docker|veth|br-|vmbr|vnet|kube`)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.Fields(line)
-		if len(parts) < 10 {
-			continue
+	return func() {
+		cur, err := getCPUTimes()
+		if err != nil {
+			log.Println("CPU 监测错误:", err)
+			return
 		}
-		dev := strings.TrimSuffix(parts[0], ":")
-		if virtRegex.MatchString(dev) {
-			continue
+		detail := newCPUBreakdown(prev, cur)
+		prev = cur
+		usage := detail.usage
+		if container != nil {
+			if percent, ok := container(); ok {
+				usage = percent
+			}
 		}
 
-		rxBytes, _ := strconv.ParseInt(parts[1], 10, 64)
-		txBytes, _ := strconv.ParseInt(parts[9], 10, 64)
-		rx += rxBytes
-		tx += txBytes
+		sampled.Lock()
+		sampled.cpu = usage
+		sampled.cpuDetail = detail
+		sampled.Unlock()
 	}
+}
 
-	return rx, tx, scanner.Err()
+// memorySample 内存与交换分区采样
+// 容器模式下若设置了内存限制, 则以 cgroup 的限制与用量代替宿主机数据
+func memorySample() {
+	cfg := getConfig()
+	memTotal, memUsed, swapTotal, swapFree, detail := getMemory(cfg)
+	if cfg.Container {
+		if cg := detectCgroup(); cg != nil {
+			if total, used, ok := cg.memoryUsage(); ok && total < memTotal {
+				memTotal, memUsed = total, used
+			}
+		}
+	}
+
+	sampled.Lock()
+	sampled.memTotal, sampled.memUsed = memTotal, memUsed
+	sampled.swapTotal, sampled.swapFree = swapTotal, swapFree
+	sampled.memDetail = detail
+	sampled.Unlock()
 }
 
-// diskIOMonitor 磁盘IO监测
-func diskIOMonitor() {
-	interval := time.Duration(*Interval) * time.Second
+// loadSample 负载与运行时间采样
+func loadSample() {
+	uptime := getUptime()
+	load1, load5, load15 := getLoad()
 
-	for {
-		// 第一次采样
-		first, err := disk.IOCounters()
-		if err != nil {
-			log.Println("磁盘 IO 监测错误:", err)
-			time.Sleep(interval)
-			continue
-		}
+	sampled.Lock()
+	sampled.uptime = uptime
+	sampled.load1, sampled.load5, sampled.load15 = load1, load5, load15
+	sampled.Unlock()
+}
 
-		time.Sleep(interval)
+// diskSample 磁盘容量采样
+func diskSample() {
+	hddTotal, hddUsed, mounts := getDisk()
 
-		// 第二次采样
-		second, err := disk.IOCounters()
-		if err != nil {
-			log.Println("磁盘 IO 监测错误:", err)
-			time.Sleep(interval)
-			continue
-		}
+	sampled.Lock()
+	sampled.hddTotal, sampled.hddUsed = hddTotal, hddUsed
+	sampled.mounts = mounts
+	sampled.Unlock()
+}
 
-		// 计算差值
-		var read, write int64
-		for device, ioFir := range first {
-			ioSec, ok := second[device]
-			if !ok || ioFir.Name != ioSec.Name {
-				continue
+// processSample 连接数与进程数采样
+func processSample() {
+	tcp, udp, process, thread, tcpStates := getTupd()
+
+	sampled.Lock()
+	sampled.tcp, sampled.udp = tcp, udp
+	sampled.process, sampled.thread = process, thread
+	sampled.tcpStates = tcpStates
+	sampled.Unlock()
+}
+
+// trafficSample 累计流量采样
+func trafficSample(cfg *Config) func() {
+	return func() {
+		var netIn, netOut uint64
+		var err error
+		if cfg.Vnstat {
+			netIn, netOut, err = trafficVnstat(cfg)
+			if err != nil {
+				log.Println("Vnstat 错误:", err)
 			}
-			read += int64(ioSec.ReadBytes  - ioFir.ReadBytes )
-			write += int64(ioSec.WriteBytes  - ioFir.WriteBytes)
+		} else {
+			var rx, tx int64
+			rx, tx, err = getNetBytes()
+			netIn, netOut = uint64(rx), uint64(tx)
 		}
 
-		diskIO.Lock()
-		diskIO.read = read
-		diskIO.write = write
-		diskIO.Unlock()
+		if err == nil {
+			sampled.Lock()
+			sampled.netIn, sampled.netOut = netIn, netOut
+			sampled.traffic = nil
+			sampled.Unlock()
+		}
 	}
 }
 
+// 当前与服务器的连接, 重新加载配置后需要重连时关闭
+var activeConn = struct {
+	sync.Mutex
+	conn net.Conn
+}{}
+
+// closeActiveConn 关闭当前连接, 主循环随后会按新配置重新连接
+func closeActiveConn() {
+	activeConn.Lock()
+	defer activeConn.Unlock()
+	if activeConn.conn != nil {
+		activeConn.conn.Close()
+	}
+}
 
 // 连接服务器并发送状态数据
 func connect() {
-	src := fmt.Sprintf("连接:%s:%d", *Server, *Port)
+	cfg := getConfig()
+	src := fmt.Sprintf("连接:%s:%d", cfg.Host, cfg.Port)
 	log.Println(src)
-	conn, err := net.DialTimeout("tcp", net.JoinHostPort(*Server, strconv.Itoa(*Port)), 30*time.Second)
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)), 30*time.Second)
 	if err != nil {
 		log.Println("连接失败:", err)
 		return
 	}
 	defer conn.Close()
 
+	activeConn.Lock()
+	activeConn.conn = conn
+	activeConn.Unlock()
+	defer func() {
+		activeConn.Lock()
+		activeConn.conn = nil
+		activeConn.Unlock()
+	}()
+
 	// 处理认证
-	if !handleAuth(conn) {
+	rest, ok := handleAuth(conn, cfg)
+	if !ok {
 		return
 	}
 
 	// 处理监控配置
-	checkIP, err := handleMonitorConfig(conn)
-	if err != nil {
+	if err := handleMonitorConfig(conn, rest); err != nil {
 		log.Println("处理监控配置错误:", err)
 		return
 	}
 
+	select {
+	case onlineTrigger <- struct{}{}:
+	default:
+	}
+
 	// 发送状态数据循环
-	sendStatusLoop(conn, checkIP)
+	sendStatusLoop(conn)
 }
 
 // 处理认证流程
-func handleAuth(conn net.Conn) bool {
+// 认证成功后返回与认证结果一起收到的后续数据
+func handleAuth(conn net.Conn, cfg *Config) (string, bool) {
 	buf := make([]byte, 1024)
 	n, err := conn.Read(buf)
 	if err != nil || !strings.Contains(string(buf[:n]), "Authentication required") {
 		log.Println("检测认证需求失败:", err)
-		return false
+		return "", false
 	}
 
 	// 发送认证信息
-	_, err = conn.Write([]byte(*User + ":" + *Password + "\n"))
+	_, err = conn.Write([]byte(cfg.User + ":" + cfg.Password + "\n"))
 	if err != nil {
 		log.Println("发送认证信息失败:", err)
-		return false
+		return "", false
 	}
 
 	// 验证认证结果
 	n, err = conn.Read(buf)
 	if err != nil || !strings.Contains(string(buf[:n]), "Authentication successful") {
 		log.Println("认证失败:", string(buf[:n]), err)
-		return false
+		return "", false
 	}
 
-	return true
+	msg := string(buf[:n])
+	_, rest, _ := strings.Cut(msg[strings.Index(msg, "Authentication successful"):], "\n")
+	return rest, true
 }
 
-// 处理监控配置并返回需要检查的IP版本
-func handleMonitorConfig(conn net.Conn) (int, error) {
-	buf := make([]byte, 1024)
-	n, err := conn.Read(buf)
-	if err != nil {
-		return 0, err
-	}
-	data := string(buf[:n])
-
-	// 确定需要检查的IP版本
-	checkIP := 0
-	if strings.Contains(data, "IPv4") {
-		checkIP = 6
-	} else if strings.Contains(data, "IPv6") {
-		checkIP = 4
-	} else {
-		return 0, fmt.Errorf("未知的连接方式")
-	}
-
-	// 解析监控服务器配置
-	monitorServer.Lock()
-	defer monitorServer.Unlock()
-	monitorServer.servers = make(map[string]*MonitorServer) // 重置
-
-	lines := strings.Split(data, "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "monitor") && strings.Contains(line, "type") && strings.Contains(line, "{") && strings.Contains(line, "}") {
-			start := strings.Index(line, "{")
-			end := strings.LastIndex(line, "}") + 1
-			if start == -1 || end == 0 {
-				continue
-			}
+// 等待服务器告知连接方式的最长时间
+const monitorConfigTimeout = 10 * time.Second
 
-			var cfg struct {
-				Name     string `json:"name"`
-				Type     string `json:"type"`
-				Host     string `json:"host"`
-				Interval int    `json:"interval"`
-			}
-			if err := json.Unmarshal([]byte(line[start:end]), &cfg); err != nil {
-				continue
-			}
+// 连接方式之后, 超过该时间没有收到新数据即认为监控项已发送完毕
+const monitorConfigWait = 500 * time.Millisecond
+
+// 处理服务器下发的监控配置
+// 服务器逐行发送连接方式与各监控项, 每行单独发送, 可能分多次到达,
+// 因此一直读取到 monitorConfigWait 内没有新数据为止, 避免漏掉监控项而误停未变化的监控
+func handleMonitorConfig(conn net.Conn, data string) error {
+	defer conn.SetReadDeadline(time.Time{})
+	buf := make([]byte, 1024)
 
-			ms := &MonitorServer{
-				Type: cfg.Type,
-				host: cfg.Host,
-				interval: cfg.Interval,
-				stop:     make(chan struct{}),
+	// 服务器告知的连接方式只用于确认握手, 两个IP版本的在线状态都会独立检查
+	conn.SetReadDeadline(time.Now().Add(monitorConfigTimeout))
+	for !strings.Contains(data, "IPv4") && !strings.Contains(data, "IPv6") {
+		n, err := conn.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return fmt.Errorf("未知的连接方式")
 			}
-			monitorServer.servers[cfg.Name] = ms
-			go monitorWorker(cfg.Name, ms)
+			return err
 		}
+		data += string(buf[:n])
 	}
 
-	return checkIP, nil
-}
-
-// monitorWorker 自定义服务器监控工作线程
-func monitorWorker(name string, ms *MonitorServer) {
-	lostCount := 0
-	history := make([]int, 0, OnlinePacketHistoryLen)
-	userInterval := time.Duration(ms.interval) * time.Second
-	interval := userInterval // 初始间隔
-
 	for {
-		select {
-		case <-ms.stop:
-			return
-		default:
-		}
-
-		// 检查服务器是否仍在监控列表中
-		monitorServer.RLock()
-		_, exists := monitorServer.servers[name]
-		monitorServer.RUnlock()
-		if !exists {
-			return
-		}
-
-		// 维护历史队列
-		if len(history) >= OnlinePacketHistoryLen {
-			if history[0] == 0 {
-				lostCount--
+		conn.SetReadDeadline(time.Now().Add(monitorConfigWait))
+		n, err := conn.Read(buf)
+		data += string(buf[:n])
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
 			}
-			history = history[1:]
-			interval = userInterval * 5 // 每次检查后增加间隔
-		}
-
-		// 执行监控检查
-		success, dnsTime, connectTime, downloadTime := monitorCheck(ms.Type, ms.host)
-		if success {
-			history = append(history, 1)
-			ms.DnsTime = dnsTime
-			ms.ConnectTime = connectTime
-			ms.DownloadTime = downloadTime
-		} else {
-			lostCount++
-			history = append(history, 0)
+			return err
 		}
-
-		// 计算在线率
-		if len(history) > 5 {
-			ms.OnlineRate = 1 - float64(lostCount)/float64(len(history))
-		}
-
-		time.Sleep(interval)
 	}
-}
 
-// monitorCheck 执行具体协议的监控检查
-func monitorCheck(protocol, host string) (success bool, dnsTime, connectTime, downloadTime int) {
-	switch protocol {
-	case "http", "https":
-		return monitorHTTP(protocol, host)
-	case "tcp":
-		return monitorTCP(host)
-	default:
-		return false, 0, 0, 0
-	}
+	updateMonitors(parseMonitorSpecs(data))
+	return nil
 }
 
-// monitorHTTP HTTP/HTTPS监控
-func monitorHTTP(protocol, host string) (success bool, dnsTime, connectTime, downloadTime int) {
-	address := strings.TrimPrefix(host, protocol+"://")
-	port := 80
-	if protocol == "https" {
-		port = 443
-	}
+// maxUpdateLine update 行(含换行符)的长度上限
+// 服务器按行读取, 行缓冲为 1400 字节(NET_MAX_PACKETSIZE), 一行超过缓冲区时会断开客户端
+const maxUpdateLine = 1350
 
-	// DNS解析时间
-	start := time.Now()
-	ip, err := resolveIP(address)
-	if err != nil {
-		return false, 0, 0, 0
+// encodeStatus 生成 update 行
+// 设置了 extended_file 时扩展数据写入该文件, 不随 update 发送;
+// 否则整行超过 maxUpdateLine 时去掉扩展数据, 仍然超长时截短 custom, 保证服务器能够接收
+func encodeStatus(status ServerStatus, cfg *Config, warned map[string]bool) ([]byte, error) {
+	if cfg.ExtendedFile != "" && status.Extended != nil {
+		if err := writeExtendedFile(cfg.ExtendedFile, status.Extended); err != nil && !warned["file"] {
+			log.Println("写入扩展数据文件失败:", err)
+			warned["file"] = true
+		}
+		status.Extended = nil
 	}
-	dnsTime = int(time.Since(start).Milliseconds())
 
-	// 连接时间
-	start = time.Now()
-	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, strconv.Itoa(port)), 6*time.Second)
-	if err != nil {
-		return false, dnsTime, 0, 0
+	line, err := marshalUpdate(status)
+	if err != nil || len(line) <= maxUpdateLine {
+		return line, err
 	}
-	defer conn.Close()
-	connectTime = int(time.Since(start).Milliseconds())
-
-	// 创建一个 HTTP 客户端
-	client := &http.Client{
-		// 设置超时，包括建立连接、发送请求和接收响应的总时间
-		Timeout: 5 * time.Second,
-		// 使用自定义的 Transport，以复用 net.DialTimeout 的能力
-		Transport: &http.Transport{
-			// 配置 TLS，通过 InsecureSkipVerify: true 来跳过证书验证
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			DialContext: (&net.Dialer{
-				Timeout: 5 * time.Second,
-			}).DialContext,
-		},
+	if status.Extended == nil {
+		return trimCustom(status, warned)
 	}
-
-	// 构造完整的 URL
-	url := host
-
-	// 发送 GET 请求
-	resp, err := client.Get(url)
-	if err != nil {
-		log.Printf("请求失败: %v\n", err)
-		return false, dnsTime, connectTime, 0
+	if !warned["extended"] {
+		log.Printf("update 数据长度 %d 字节超过服务器行缓冲, 不再发送扩展数据, 可改用 -extendedFile\n", len(line))
+		warned["extended"] = true
 	}
-	defer resp.Body.Close()
-
-	// 从响应中获取状态码
-	statusCode := resp.StatusCode
-	code := strconv.Itoa(statusCode)
-	validCodes := map[string]bool{"200": true, "204": true, "301": true, "302": true, "401": true}
-	if !validCodes[code] {
-		return false, dnsTime, connectTime, 0
-	}
-
-	downloadTime = int(time.Since(start).Milliseconds())
-	return true, dnsTime, connectTime, downloadTime
+	status.Extended = nil
+	return trimCustom(status, warned)
 }
 
-// monitorTCP TCP监控
-func monitorTCP(host string) (success bool, dnsTime, connectTime, downloadTime int) {
-	parts := strings.Split(host, ":")
-	if len(parts) != 2 {
-		return false, 0, 0, 0
-	}
-	address, portStr := parts[0], parts[1]
-	port, err := strconv.Atoi(portStr)
-	if err != nil {
-		return false, 0, 0, 0
+// trimCustom 去掉扩展数据后仍然超长时, 从末尾起逐段去掉 custom 的内容
+func trimCustom(status ServerStatus, warned map[string]bool) ([]byte, error) {
+	line, err := marshalUpdate(status)
+	for err == nil && len(line) > maxUpdateLine && status.Custom != "" {
+		if !warned["custom"] {
+			log.Printf("update 数据长度 %d 字节超过服务器行缓冲, 截去部分 custom 内容\n", len(line))
+			warned["custom"] = true
+		}
+		if i := strings.LastIndex(status.Custom, "<br>"); i >= 0 {
+			status.Custom = status.Custom[:i]
+		} else {
+			status.Custom = ""
+		}
+		line, err = marshalUpdate(status)
 	}
+	return line, err
+}
 
-	// DNS解析时间
-	start := time.Now()
-	ip, err := resolveIP(address)
+// marshalUpdate 序列化为一行 update 数据
+func marshalUpdate(status ServerStatus) ([]byte, error) {
+	data, err := json.Marshal(status)
 	if err != nil {
-		return false, 0, 0, 0
+		return nil, err
 	}
-	dnsTime = int(time.Since(start).Milliseconds())
+	return []byte("update " + string(data) + "\n"), nil
+}
 
-	// 连接时间
-	start = time.Now()
-	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, strconv.Itoa(port)), 6*time.Second)
+// writeExtendedFile 将扩展数据写入文件, 先写临时文件再改名, 读取方不会读到写了一半的内容
+func writeExtendedFile(path string, extended *ExtendedStatus) error {
+	data, err := json.Marshal(extended)
 	if err != nil {
-		return false, dnsTime, 0, 0
+		return err
 	}
-	defer conn.Close()
-	connectTime = int(time.Since(start).Milliseconds())
-
-	// 下载时间
-	start = time.Now()
-	if _, err := conn.Write([]byte("GET / HTTP/1.2\r\n\r\n")); err != nil {
-		return false, dnsTime, connectTime, 0
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
 	}
-	buf := make([]byte, 1024)
-	if _, err := conn.Read(buf); err != nil && err != io.EOF {
-		return false, dnsTime, connectTime, 0
-	}
-	downloadTime = int(time.Since(start).Milliseconds())
-
-	return true, dnsTime, connectTime, downloadTime
+	return os.Rename(tmp, path)
 }
 
 // 发送状态数据循环
-func sendStatusLoop(conn net.Conn, checkIP int) {
-	timer := 0.0
-	interval := time.Duration(*Interval) * time.Second
+// 按固定节拍发送各采样线程的最新结果, 采样耗时不会拖慢发送
+func sendStatusLoop(conn net.Conn) {
+	interval := seconds(getConfig().Interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	warned := make(map[string]bool) // 同一问题只记录一次日志
 
 	for {
 		// 收集系统状态数据
-		status := collectStatus(checkIP, &timer)
+		status := collectStatus()
 
 		// 序列化并发送
-		data, err := json.Marshal(status)
+		line, err := encodeStatus(status, getConfig(), warned)
 		if err != nil {
 			log.Println("序列化状态数据错误:", err)
 			break
 		}
 
-		_, err = conn.Write([]byte("update " + string(data) + "\n"))
+		_, err = conn.Write(line)
 		if err != nil {
 			log.Println("发送状态数据错误:", err)
 			break
 		}
 
-		time.Sleep(interval)
-	}
-}
-
-// 收集系统状态数据
-func collectStatus(checkIP int, timer *float64) ServerStatus {
-	// CPU使用率
-	cpu := getCPU()
-
-	// 网络流量
-	var netIn, netOut uint64
-	var err error
-	if *IsVnstat {
-		netIn, netOut, err = trafficVnstat()
-		if err != nil {
-			log.Println("Vnstat 错误:", err)
+		<-ticker.C
+		if d := seconds(getConfig().Interval); d != interval {
+			interval = d
+			ticker.Reset(interval)
 		}
-	} else {
-		rx, tx, _ := getNetBytes()
-		netIn, netOut = uint64(rx), uint64(tx)
 	}
+}
 
+// 汇总各采样线程的最新结果
+func collectStatus() ServerStatus {
 	// 网络速率
 	netSpeed.Lock()
-	netRx, netTx := netSpeed.netrx, netSpeed.nettx
+	netRx, netTx, ifaces := netSpeed.netrx, netSpeed.nettx, netSpeed.ifaces
 	netSpeed.Unlock()
 
-	// 内存信息
-	memTotal, memUsed, swapTotal, swapFree := getMemory()
-
-	// 磁盘信息
-	hddTotal, hddUsed := getDisk()
-
-	// 系统负载
-	load1, load5, load15 := getLoad()
-
-	// 在线状态检查
-	var online4, online6 bool
-	if *timer <= 0 {
-		if checkIP == 4 {
-			online4 = checkNetwork(4)
-		} else {
-			online6 = checkNetwork(6)
-		}
-		*timer = 150.0 // 每150秒检查一次
-	}
-	*timer -= *Interval
-
-	// Ping数据
-	if val, ok := lostRate.Load("CU"); ok {
-		pingCU = val.(float64)
-	}
-	if val, ok := lostRate.Load("CM"); ok {
-		pingCM = val.(float64)
-	}
-	if val, ok := lostRate.Load("CT"); ok {
-		pingCT = val.(float64)
-	}
-
-	if val, ok := pingTime.Load("CU"); ok {
-		timeCU = val.(int)
-	}
-	if val, ok := pingTime.Load("CM"); ok {
-		timeCM = val.(int)
-	}
-	if val, ok := pingTime.Load("CT"); ok {
-		timeCT = val.(int)
-	}
-
-	// 连接数和进程数
-	tcp, udp, process, thread := getTupd()
-
 	// 磁盘IO
 	diskIO.Lock()
-	ioRead, ioWrite := diskIO.read, diskIO.write
+	ioRead, ioWrite, ioDevices := diskIO.read, diskIO.write, diskIO.devices
 	diskIO.Unlock()
 
 	// 自定义监控数据
-	custom := getCustomMonitorData()
+	cfg := getConfig()
+	custom := buildCustom(cfg)
+
+	// 延迟探测数据, 由 probe.legacy 指定的目标上报到服务器原有的字段
+	probes := probeResults(cfg)
+	pingCU, timeCU := legacyProbe(probes, cfg.Probe.Legacy.CU)
+	pingCT, timeCT := legacyProbe(probes, cfg.Probe.Legacy.CT)
+	pingCM, timeCM := legacyProbe(probes, cfg.Probe.Legacy.CM)
+
+	sampled.RLock()
+	defer sampled.RUnlock()
+
+	var extended *ExtendedStatus
+	if cfg.Extended || cfg.ExtendedFile != "" {
+		extended = &ExtendedStatus{
+			TCPStates: sampled.tcpStates,
+			CPU: &ExtendedCPU{
+				IOWait: jsoniter.Number(fmt.Sprintf("%.1f", sampled.cpuDetail.iowait)),
+				Steal:  jsoniter.Number(fmt.Sprintf("%.1f", sampled.cpuDetail.steal)),
+				Cores:  formatPercents(sampled.cpuDetail.cores),
+			},
+			Memory: &ExtendedMemory{
+				Available: sampled.memDetail.available,
+				Shmem:     sampled.memDetail.shmem,
+				Dirty:     sampled.memDetail.dirty,
+				ZfsArc:    sampled.memDetail.zfsArc,
+			},
+			Disks:      sampled.mounts,
+			DiskIO:     ioDevices,
+			Interfaces: ifaces,
+			Traffic:    sampled.traffic,
+			Probes:     probes,
+			Online:     sampled.online,
+			Monitors:   monitorResults(),
+		}
+	}
 
 	return ServerStatus{
-		Uptime:      getUptime(),
-		Load1:       jsoniter.Number(fmt.Sprintf("%.2f", load1)),
-		Load5:       jsoniter.Number(fmt.Sprintf("%.2f", load5)),
-		Load15:      jsoniter.Number(fmt.Sprintf("%.2f", load15)),
-		MemoryTotal: memTotal,
-		MemoryUsed:  memUsed,
-		SwapTotal:   swapTotal,
-		SwapUsed:    swapTotal - swapFree,
-		HddTotal:    hddTotal,
-		HddUsed:     hddUsed,
-		CPU:         jsoniter.Number(fmt.Sprintf("%.1f", cpu)),
+		Uptime:      sampled.uptime,
+		Load1:       jsoniter.Number(fmt.Sprintf("%.2f", sampled.load1)),
+		Load5:       jsoniter.Number(fmt.Sprintf("%.2f", sampled.load5)),
+		Load15:      jsoniter.Number(fmt.Sprintf("%.2f", sampled.load15)),
+		MemoryTotal: sampled.memTotal,
+		MemoryUsed:  sampled.memUsed,
+		SwapTotal:   sampled.swapTotal,
+		SwapUsed:    sampled.swapTotal - sampled.swapFree,
+		HddTotal:    sampled.hddTotal,
+		HddUsed:     sampled.hddUsed,
+		CPU:         jsoniter.Number(fmt.Sprintf("%.1f", sampled.cpu)),
 		NetworkRx:   netRx,
 		NetworkTx:   netTx,
-		NetworkIn:   netIn,
-		NetworkOut:  netOut,
-		Online4:     online4,
-		Online6:     online6,
+		NetworkIn:   sampled.netIn,
+		NetworkOut:  sampled.netOut,
+		Online4:     sampled.online4,
+		Online6:     sampled.online6,
 		PingCU:      pingCU,
 		PingCM:      pingCM,
 		PingCT:      pingCT,
 		TimeCU:      timeCU,
 		TimeCT:      timeCT,
 		TimeCM:      timeCM,
-		TCP:         tcp,
-		UDP:         udp,
-		Process:     process,
-		Thread:      thread,
+		TCP:         sampled.tcp,
+		UDP:         sampled.udp,
+		Process:     sampled.process,
+		Thread:      sampled.thread,
 		IoRead:      ioRead,
 		IoWrite:     ioWrite,
 		Custom:      custom,
+		Extended:    extended,
 	}
 }
 
 // 系统信息收集函数（底层实现）
 func getUptime() uint64 {
-	data, err := os.ReadFile("/proc/uptime")
+	data, err := os.ReadFile(procPath("uptime"))
 	if err != nil {
 		return 0
 	}
@@ -785,108 +763,8 @@ func getUptime() uint64 {
 	return uptime
 }
 
-func getMemory() (total, used, swapTotal, swapFree uint64) {
-	data, err := os.ReadFile("/proc/meminfo")
-	if err != nil {
-		return 0, 0, 0, 0
-	}
-
-	memInfo := make(map[string]uint64)
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		parts := strings.Fields(line)
-		if len(parts) >= 2 {
-			val, _ := strconv.ParseUint(parts[1], 10, 64)
-			memInfo[parts[0]] = val
-		}
-	}
-
-	total = memInfo["MemTotal:"]
-	free := memInfo["MemFree:"]
-	buffers := memInfo["Buffers:"]
-	cached := memInfo["Cached:"]
-	sreclaimable := memInfo["SReclaimable:"]
-	used = total - free - buffers - cached - sreclaimable
-
-	swapTotal = memInfo["SwapTotal:"]
-	swapFree = memInfo["SwapFree:"]
-
-	return total, used, swapTotal, swapFree
-}
-
-func getDisk() (total, used uint64) {
-
-	diskList, _ := disk.Partitions(false)
-	devices := make(map[string]struct{})
-	for _, disk := range diskList {
-		_, ok := devices[disk.Device]
-		if !ok && checkValidFs(disk.Fstype) {
-			CachedFs[disk.Mountpoint] = struct{}{}
-			devices[disk.Device] = struct{}{}
-		}
-	}
-
-	for k := range CachedFs {
-		usage, err := disk.Usage(k)
-		if err != nil {
-			delete(CachedFs, k)
-			continue
-		}
-		total += usage.Total / 1024.0 / 1024.0
-		used += usage.Used / 1024.0 / 1024.0
-	}
-	return total, used
-}
-
-func getCPU() float64 {
-	// 读取初始CPU时间
-	start, err := getCPUTime()
-	if err != nil {
-		return 0
-	}
-	time.Sleep(time.Duration(*Interval) * time.Second)
-
-	// 读取结束CPU时间
-	end, err := getCPUTime()
-	if err != nil {
-		return 0
-	}
-
-	// 计算总时间和空闲时间差值
-	total := end.user + end.nice + end.system + end.idle - (start.user + start.nice + start.system + start.idle)
-	idle := end.idle - start.idle
-
-	if total == 0 {
-		return 0
-	}
-	return 100 - (float64(idle) / float64(total) * 100)
-}
-
-type cpuTime struct {
-	user, nice, system, idle uint64
-}
-
-func getCPUTime() (cpuTime, error) {
-	data, err := os.ReadFile("/proc/stat")
-	if err != nil {
-		return cpuTime{}, err
-	}
-
-	parts := strings.Fields(string(data))
-	if len(parts) < 5 {
-		return cpuTime{}, fmt.Errorf("CPU时间数据格式错误")
-	}
-
-	user, _ := strconv.ParseUint(parts[1], 10, 64)
-	nice, _ := strconv.ParseUint(parts[2], 10, 64)
-	system, _ := strconv.ParseUint(parts[3], 10, 64)
-	idle, _ := strconv.ParseUint(parts[4], 10, 64)
-
-	return cpuTime{user, nice, system, idle}, nil
-}
-
 func getLoad() (load1, load5, load15 float64) {
-	data, err := os.ReadFile("/proc/loadavg")
+	data, err := os.ReadFile(procPath("loadavg"))
 	if err != nil {
 		return 0, 0, 0
 	}
@@ -900,108 +778,19 @@ func getLoad() (load1, load5, load15 float64) {
 	return load1, load5, load15
 }
 
-func checkValidFs(name string) bool {
-	for _, v := range ValidFs {
-		if strings.ToLower(name) == v {
-			return true
-		}
-	}
-	return false
-}
-
-func checkNetwork(version int) bool {
-	host := "ipv4.google.com"
-	if version == 6 {
-		host = "ipv6.google.com"
-	}
-	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, "80"), 2*time.Second)
-	if err != nil {
-		return false
-	}
-	conn.Close()
-	return true
-}
-
-func trafficVnstat() (uint64, uint64, error) {
-	buf, err := exec.Command("vnstat", "--oneline", "b").Output()
-	if err != nil {
-		return 0, 0, err
-	}
-	vData := strings.Split(BytesToString(buf), ";")
-	if len(vData) != 15 {
-		// Not enough data available yet.
-		return 0, 0, nil
-	}
-	netIn, err := strconv.ParseUint(vData[8], 10, 64)
-	if err != nil {
-		return 0, 0, err
-	}
-	netOut, err := strconv.ParseUint(vData[9], 10, 64)
-	if err != nil {
-		return 0, 0, err
-	}
-	return netIn, netOut, nil
-}
-
-func getTupd() (tcp, udp, process, thread int) {
-	// TCP连接数
-	tcpOut, _ := exec.Command("sh", "-c", "ss -t | wc -l").Output()
-	tcp, _ = strconv.Atoi(strings.TrimSpace(string(tcpOut)))
-	tcp = max(tcp-1, 0) // 减去表头
-	if tcp == 0 {
-		tcpOut, _ = exec.Command("sh", "-c", "netstat -ant | grep '^tcp' | wc -l").Output()
-		tcp, _ = strconv.Atoi(strings.TrimSpace(string(tcpOut)))
-		tcp = max(tcp-1, 0) // 减去表头和空行
-	}
-
-	// UDP连接数
-	udpOut, _ := exec.Command("sh", "-c", "ss -u | wc -l").Output()
-	udp, _ = strconv.Atoi(strings.TrimSpace(string(udpOut)))
-	udp = max(udp-1, 0)
-	if udp == 0 {
-		udpOut, _ = exec.Command("sh", "-c", "netstat -anu | grep '^udp' | wc -l").Output()
-		udp, _ = strconv.Atoi(strings.TrimSpace(string(udpOut)))
-		udp = max(udp-1, 0) // 减去表头和空行
-	}
-
-	// 进程数
-	procOut, _ := exec.Command("sh", "-c", "ps -ef | wc -l").Output()
-	process, _ = strconv.Atoi(strings.TrimSpace(string(procOut)))
-	process = max(process-2, 0)
-
-	// 线程数
-	threadOut, _ := exec.Command("sh", "-c", "ps -eLf | wc -l").Output()
-	thread, _ = strconv.Atoi(strings.TrimSpace(string(threadOut)))
-	thread = max(thread-2, 0)
-	if thread == 0 {
-		threadOut, _ = exec.Command("sh", "-c", "grep -c ^Threads: /proc/*/status | wc -l").Output()
-		thread, _ = strconv.Atoi(strings.TrimSpace(string(threadOut)))
-		thread = max(thread-1, 0) // 减去表头
-	}
-
-	return tcp, udp, process, thread
-}
-
-func getCustomMonitorData() string {
-	monitorServer.RLock()
-	defer monitorServer.RUnlock()
-
-	var parts []string
-	for name, ms := range monitorServer.servers {
-		part := fmt.Sprintf("%s\\t解析: %d\\t连接: %d\\t下载: %d\\t在线率: <code>%.1f%%</code>",
-			name, ms.DnsTime, ms.ConnectTime, ms.DownloadTime, ms.OnlineRate*100)
-		parts = append(parts, part)
-	}
-	return strings.Join(parts, "<br>")
-}
-
-func BytesToString(b []byte) string {
-	return *(*string)(unsafe.Pointer(&b))
+// ExtendedMemory 内存明细(KB)
+type ExtendedMemory struct {
+	Available uint64 `json:"available"`
+	Shmem     uint64 `json:"shmem"`
+	Dirty     uint64 `json:"dirty"`
+	ZfsArc    uint64 `json:"zfs_arc,omitempty"`
 }
 
-func max(a, b int) int {
-	if a > b {
-		return a
+// formatPercents 将百分比保留一位小数
+func formatPercents(vals []float64) []jsoniter.Number {
+	nums := make([]jsoniter.Number, len(vals))
+	for i, v := range vals {
+		nums[i] = jsoniter.Number(fmt.Sprintf("%.1f", v))
 	}
-	return b
+	return nums
 }
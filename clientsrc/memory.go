@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 内存用量计算方式
+const (
+	// memoryModeLegacy 总内存减去 MemFree、Buffers、Cached 与 SReclaimable
+	memoryModeLegacy = "legacy"
+	// memoryModeAvailable 总内存减去内核估算的可用内存 MemAvailable
+	// Cached 中包含无法回收的 shmem(tmpfs 等), legacy 方式会将其误算为空闲
+	memoryModeAvailable = "available"
+)
+
+// memoryDetail 内存明细(KB), 用于扩展字段
+type memoryDetail struct {
+	available uint64
+	shmem     uint64
+	dirty     uint64
+	zfsArc    uint64
+}
+
+// getMemory 读取 /proc/meminfo 计算内存与交换分区用量(KB)
+func getMemory(cfg *Config) (total, used, swapTotal, swapFree uint64, detail memoryDetail) {
+	data, err := os.ReadFile(procPath("meminfo"))
+	if err != nil {
+		return 0, 0, 0, 0, detail
+	}
+
+	memInfo := make(map[string]uint64)
+	lines := strings.Split(string(data), "\n")
+	for _, line := range lines {
+		parts := strings.Fields(line)
+		if len(parts) >= 2 {
+			val, _ := strconv.ParseUint(parts[1], 10, 64)
+			memInfo[parts[0]] = val
+		}
+	}
+
+	total = memInfo["MemTotal:"]
+	available, hasAvailable := memInfo["MemAvailable:"]
+	if cfg.Memory.Mode == memoryModeAvailable && hasAvailable {
+		used = saturatingSub(total, available)
+	} else {
+		// 3.14 之前的内核没有 MemAvailable
+		free := memInfo["MemFree:"]
+		buffers := memInfo["Buffers:"]
+		cached := memInfo["Cached:"]
+		sreclaimable := memInfo["SReclaimable:"]
+		used = saturatingSub(total, free+buffers+cached+sreclaimable)
+	}
+
+	detail = memoryDetail{
+		available: available,
+		shmem:     memInfo["Shmem:"],
+		dirty:     memInfo["Dirty:"],
+	}
+	if cfg.Memory.ZfsArc {
+		// ARC 由 ZFS 自行管理, 内核将其计为已用, 但内存紧张时会被释放
+		detail.zfsArc = getZfsArcSize() / 1024
+		used = saturatingSub(used, detail.zfsArc)
+	}
+
+	swapTotal = memInfo["SwapTotal:"]
+	swapFree = memInfo["SwapFree:"]
+
+	return total, used, swapTotal, swapFree, detail
+}
+
+// getZfsArcSize 读取 ZFS ARC 当前大小(字节), 未加载 ZFS 时返回0
+func getZfsArcSize() uint64 {
+	f, err := os.Open(procPath("spl", "kstat", "zfs", "arcstats"))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	// 格式: name type data, 前两行为 kstat 头部
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == "size" {
+			size, _ := strconv.ParseUint(fields[2], 10, 64)
+			return size
+		}
+	}
+	return 0
+}
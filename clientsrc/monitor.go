@@ -0,0 +1,593 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MonitorServer 自定义服务器监控数据
+type MonitorServer struct {
+	Type          string  `json:"type"`
+	DnsTime       int     `json:"dns_time"`
+	ConnectTime   int     `json:"connect_time"`
+	TLSTime       int     `json:"tls_time"` // TLS 握手耗时
+	TLSVersion    string  `json:"tls_version,omitempty"`
+	TLSCipher     string  `json:"tls_cipher,omitempty"`
+	FirstByteTime int     `json:"first_byte_time"` // 连接就绪到收到首字节
+	DownloadTime  int     `json:"download_time"`
+	OnlineRate    float64 `json:"online_rate"`
+	Error         string  `json:"error,omitempty"` // 最近一次检查失败的原因, 成功后清空
+	MonitorCert
+}
+
+// monitorSpec 服务器下发的单个监控项
+type monitorSpec struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Host     string `json:"host"`
+	Interval int    `json:"interval"`
+	MonitorOptions
+
+	schedule ProbeSchedule // 本地 monitor.schedule, 参与比较, 修改后重启工作线程
+}
+
+// monitorInstance 一个正在运行的监控项
+// result 由工作线程写入, 读取时须持有 mu
+type monitorInstance struct {
+	spec   monitorSpec
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	result MonitorServer
+}
+
+// 正在运行的监控项, 按名称索引
+var monitors = struct {
+	sync.Mutex
+	received []monitorSpec // 服务器最近一次下发的监控项
+	running  map[string]*monitorInstance
+}{
+	running: make(map[string]*monitorInstance),
+}
+
+// 服务器下发的 interval 缺失或不大于 0 时使用的检查间隔(秒)
+const defaultMonitorInterval = 60
+
+// parseMonitorSpecs 从服务器下发的配置中解析监控项
+// 每个监控项为一行 JSON, 无法解析的行被忽略
+func parseMonitorSpecs(data string) []monitorSpec {
+	var specs []monitorSpec
+	for _, line := range strings.Split(data, "\n") {
+		if !strings.Contains(line, "monitor") || !strings.Contains(line, "type") {
+			continue
+		}
+		start := strings.Index(line, "{")
+		end := strings.LastIndex(line, "}") + 1
+		if start == -1 || end <= start {
+			continue
+		}
+
+		var spec monitorSpec
+		if err := json.Unmarshal([]byte(line[start:end]), &spec); err != nil {
+			continue
+		}
+		if err := spec.MonitorOptions.validate(); err != nil {
+			log.Printf("忽略监控项 %s: %v\n", spec.Name, err)
+			continue
+		}
+		if spec.Interval <= 0 {
+			log.Printf("监控项 %s 的 interval 无效(%d), 改为每 %d 秒检查一次\n", spec.Name, spec.Interval, defaultMonitorInterval)
+			spec.Interval = defaultMonitorInterval
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// updateMonitors 按服务器下发的监控项调整工作线程
+// 被移除或配置变化的监控项会被停止, 新增的监控项会被启动,
+// 未变化的监控项继续运行并保留在线率历史, 重连不会产生重复的工作线程
+func updateMonitors(specs []monitorSpec) {
+	monitors.Lock()
+	defer monitors.Unlock()
+	monitors.received = specs
+	applyMonitorsLocked()
+}
+
+// applyMonitors 重新加载配置后按新的 monitor.schedule 与 monitor.overlay 调整工作线程
+func applyMonitors() {
+	monitors.Lock()
+	defer monitors.Unlock()
+	applyMonitorsLocked()
+}
+
+func applyMonitorsLocked() {
+	cfg := getConfig()
+	overlay := cfg.Monitor.Overlay
+	wanted := make(map[string]monitorSpec, len(monitors.received))
+	for _, spec := range monitors.received {
+		spec.schedule = cfg.Monitor.Schedule
+		if opts, ok := overlay[spec.Name]; ok {
+			if opts.HTTP != nil {
+				spec.HTTP = opts.HTTP
+			}
+			if opts.TLS != nil {
+				spec.TLS = opts.TLS
+			}
+		}
+		wanted[spec.Name] = spec
+	}
+
+	for name, m := range monitors.running {
+		if spec, ok := wanted[name]; !ok || !reflect.DeepEqual(spec, m.spec) {
+			m.cancel()
+			delete(monitors.running, name)
+		}
+	}
+	for name, spec := range wanted {
+		if _, ok := monitors.running[name]; ok {
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		m := &monitorInstance{spec: spec, cancel: cancel, result: MonitorServer{Type: spec.Type}}
+		monitors.running[name] = m
+		go monitorWorker(ctx, m)
+	}
+}
+
+// snapshot 返回监控结果的副本
+func (m *monitorInstance) snapshot() MonitorServer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.result
+}
+
+// monitorWorker 自定义服务器监控工作线程, ctx 取消后退出
+// 按服务器下发的 interval 与本地 monitor.schedule 调度, 见 probeScheduler
+func monitorWorker(ctx context.Context, m *monitorInstance) {
+	lostCount := 0
+	history := make([]int, 0, OnlinePacketHistoryLen)
+	sched := newProbeScheduler(seconds(float64(m.spec.Interval)), m.spec.schedule)
+
+	if !sleepContext(ctx, sched.initialDelay()) {
+		return
+	}
+	for {
+		start := time.Now()
+
+		// 维护历史队列
+		if len(history) >= OnlinePacketHistoryLen {
+			if history[0] == 0 {
+				lostCount--
+			}
+			history = history[1:]
+		}
+
+		// 执行监控检查
+		res, err := monitorCheck(m.spec)
+		success := err == nil
+		if success {
+			history = append(history, 1)
+		} else {
+			lostCount++
+			history = append(history, 0)
+		}
+
+		m.mu.Lock()
+		if success {
+			res.Type, res.OnlineRate = m.result.Type, m.result.OnlineRate
+			m.result = res
+		} else {
+			m.result.Error = err.Error()
+			if res.CertIssuer != "" {
+				m.result.MonitorCert = res.MonitorCert
+			}
+		}
+		// 计算在线率
+		if len(history) > 5 {
+			m.result.OnlineRate = 1 - float64(lostCount)/float64(len(history))
+		}
+		m.mu.Unlock()
+
+		if !sleepContext(ctx, time.Until(start.Add(sched.next(!success)))) {
+			return
+		}
+	}
+}
+
+// monitorResult 单个监控项的最新结果, 在 extended 的 monitors 字段中上报
+type monitorResult struct {
+	Name string `json:"name"`
+	MonitorServer
+	expiryDays int
+}
+
+// monitorResults 按名称顺序返回各监控项最新结果的副本
+func monitorResults() []monitorResult {
+	monitors.Lock()
+	instances := make([]*monitorInstance, 0, len(monitors.running))
+	for _, m := range monitors.running {
+		instances = append(instances, m)
+	}
+	monitors.Unlock()
+
+	results := make([]monitorResult, len(instances))
+	for i, m := range instances {
+		results[i] = monitorResult{Name: m.spec.Name, MonitorServer: m.snapshot(), expiryDays: m.spec.TLS.expiryDays()}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results
+}
+
+// getCustomMonitorData 按名称顺序在 custom 字段中展示各监控项的最新结果
+func getCustomMonitorData() string {
+	var parts []string
+	for _, r := range monitorResults() {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s\\t解析: %d\\t连接: %d", html.EscapeString(r.Name), r.DnsTime, r.ConnectTime)
+		switch r.Type {
+		case "https":
+			fmt.Fprintf(&b, "\\tTLS: %d\\t首字节: %d\\t下载: %d", r.TLSTime, r.FirstByteTime, r.DownloadTime)
+		case "http":
+			fmt.Fprintf(&b, "\\t首字节: %d\\t下载: %d", r.FirstByteTime, r.DownloadTime)
+		case "tls", "smtp+starttls", "imap+starttls":
+			fmt.Fprintf(&b, "\\t握手: %d", r.TLSTime)
+			if r.TLSVersion != "" {
+				b.WriteString("\\t" + r.TLSVersion)
+			}
+		default:
+			fmt.Fprintf(&b, "\\t下载: %d", r.DownloadTime)
+		}
+		fmt.Fprintf(&b, "\\t在线率: <code>%.1f%%</code>", r.OnlineRate*100)
+		if r.CertIssuer != "" {
+			b.WriteString("\\t证书: " + certExpiry(r.CertDays, r.expiryDays))
+			if !r.CertValid {
+				b.WriteString(" <code>校验失败</code>")
+			}
+		}
+		if r.Error != "" {
+			fmt.Fprintf(&b, "\\t失败: %s", monitorReason(r.Error))
+		}
+		parts = append(parts, b.String())
+	}
+	return strings.Join(parts, "<br>")
+}
+
+// certExpiry 显示证书剩余天数, 已过期或不超过 expiryDays 天时标出
+func certExpiry(days, expiryDays int) string {
+	switch {
+	case days < 0:
+		return "<code>已过期</code>"
+	case days <= expiryDays:
+		return fmt.Sprintf("<code>%d天后过期</code>", days)
+	default:
+		return fmt.Sprintf("%d天", days)
+	}
+}
+
+// monitorReason 截短失败原因并转义, 避免破坏服务器生成的 JSON
+func monitorReason(reason string) string {
+	if r := []rune(reason); len(r) > 60 {
+		reason = string(r[:60]) + "..."
+	}
+	return html.EscapeString(strings.ReplaceAll(reason, "\\", "/"))
+}
+
+// 单次监控检查的超时时间
+const monitorTimeout = 6 * time.Second
+
+// monitorCheck 执行具体协议的监控检查, 返回各阶段耗时(毫秒)
+func monitorCheck(spec monitorSpec) (MonitorServer, error) {
+	switch spec.Type {
+	case "http", "https":
+		return monitorHTTP(spec)
+	case "tcp":
+		return monitorTCP(spec.Host)
+	case "tls", "smtp+starttls", "imap+starttls":
+		return monitorTLS(spec)
+	default:
+		return MonitorServer{}, fmt.Errorf("未知的监控类型 %q", spec.Type)
+	}
+}
+
+// tlsCheck 返回 TLS 校验规则, 未设置时为默认规则
+func (spec monitorSpec) tlsCheck() *TLSCheck {
+	if spec.TLS == nil {
+		return &TLSCheck{}
+	}
+	return spec.TLS
+}
+
+// monitorURL 补全监控地址的协议部分
+func monitorURL(spec monitorSpec) (*url.URL, error) {
+	raw := spec.Host
+	if !strings.Contains(raw, "://") {
+		raw = spec.Type + "://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("无效的监控地址 %q", spec.Host)
+	}
+	return u, nil
+}
+
+// monitorHTTP HTTP/HTTPS监控
+// 通过 httptrace 在同一个请求上记录解析、连接、TLS握手、首字节与下载耗时,
+// 每次检查使用新的连接且默认不跟随重定向, 各阶段耗时都属于同一个连接;
+// 跟随重定向时记录的是最后一次请求的耗时
+func monitorHTTP(spec monitorSpec) (MonitorServer, error) {
+	u, err := monitorURL(spec)
+	if err != nil {
+		return MonitorServer{}, err
+	}
+	check := spec.HTTP
+	if check == nil {
+		check = &HTTPCheck{}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), monitorTimeout)
+	defer cancel()
+
+	// 拨号与握手的回调在 Transport 的拨号线程中执行, 超时返回时可能仍在写入,
+	// 因此失败时不读取 res, 只返回加锁记录的证书信息
+	var res MonitorServer
+	var certMu sync.Mutex
+	var cert MonitorCert
+	failed := func(err error) (MonitorServer, error) {
+		certMu.Lock()
+		defer certMu.Unlock()
+		return MonitorServer{MonitorCert: cert}, err
+	}
+	tlsConfig, err := spec.tlsCheck().clientConfig(u.Hostname(), func(c MonitorCert) {
+		certMu.Lock()
+		cert = c
+		certMu.Unlock()
+	})
+	if err != nil {
+		return MonitorServer{}, err
+	}
+	var dnsStart, connectStart, tlsStart, gotConn, firstByte time.Time
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:  func(httptrace.DNSDoneInfo) { res.DnsTime = int(time.Since(dnsStart).Milliseconds()) },
+		ConnectStart: func(string, string) {
+			connectStart = time.Now()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				res.ConnectTime = int(time.Since(connectStart).Milliseconds())
+			}
+		},
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err == nil {
+				res.TLSTime = int(time.Since(tlsStart).Milliseconds())
+				res.TLSVersion = tls.VersionName(state.Version)
+				res.TLSCipher = tls.CipherSuiteName(state.CipherSuite)
+			}
+		},
+		GotConn:              func(httptrace.GotConnInfo) { gotConn = time.Now() },
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	}
+
+	// 关闭双栈并行拨号, 使连接回调依次执行
+	// IP版本偏好只作用于域名解析, 地址字面量按其自身版本连接
+	dialer := &net.Dialer{FallbackDelay: -1}
+	network := "tcp" + strings.TrimPrefix(getConfig().Probe.network, "ip")
+	if net.ParseIP(u.Hostname()) != nil {
+		network = "tcp"
+	}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+		TLSClientConfig:   tlsConfig,
+		DisableKeepAlives: true,
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport}
+	if !check.FollowRedirects {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	}
+
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), check.method(), u.String(), check.newRequestBody())
+	if err != nil {
+		return failed(err)
+	}
+	check.setHeaders(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return failed(err)
+	}
+	defer resp.Body.Close()
+	if err := check.checkStatus(resp.StatusCode); err != nil {
+		return failed(err)
+	}
+	if err := check.readBody(resp.Body); err != nil {
+		return failed(err)
+	}
+	certMu.Lock()
+	res.MonitorCert = cert
+	certMu.Unlock()
+	res.FirstByteTime = int(firstByte.Sub(gotConn).Milliseconds())
+	res.DownloadTime = int(time.Since(firstByte).Milliseconds())
+	return res, nil
+}
+
+// monitorTCP TCP监控
+func monitorTCP(host string) (MonitorServer, error) {
+	var res MonitorServer
+	address, portStr, err := net.SplitHostPort(host)
+	if err != nil {
+		return res, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return res, fmt.Errorf("无效的端口 %q", portStr)
+	}
+
+	// DNS解析时间
+	start := time.Now()
+	ip, err := resolveIP(getConfig().Probe.network, address)
+	if err != nil {
+		return res, err
+	}
+	res.DnsTime = int(time.Since(start).Milliseconds())
+
+	// 连接时间
+	start = time.Now()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, strconv.Itoa(port)), monitorTimeout)
+	if err != nil {
+		return res, err
+	}
+	defer conn.Close()
+	res.ConnectTime = int(time.Since(start).Milliseconds())
+
+	// 下载时间
+	start = time.Now()
+	conn.SetDeadline(start.Add(monitorTimeout))
+	if _, err := conn.Write([]byte("GET / HTTP/1.2\r\n\r\n")); err != nil {
+		return res, err
+	}
+	buf := make([]byte, 1024)
+	if _, err := conn.Read(buf); err != nil && err != io.EOF {
+		return res, err
+	}
+	res.DownloadTime = int(time.Since(start).Milliseconds())
+	return res, nil
+}
+
+// STARTTLS 监控未指定端口时使用的端口
+var starttlsPorts = map[string]string{
+	"smtp+starttls": "25",
+	"imap+starttls": "143",
+}
+
+// monitorTLS TLS证书监控, 用于无法发出HTTP请求的服务
+// 完成握手后记录握手耗时、协商的版本与加密套件、证书链是否有效以及证书信息;
+// smtp+starttls / imap+starttls 先以明文完成协议问候并请求 STARTTLS
+func monitorTLS(spec monitorSpec) (MonitorServer, error) {
+	var res MonitorServer
+	host, port, err := net.SplitHostPort(spec.Host)
+	if err != nil {
+		def, ok := starttlsPorts[spec.Type]
+		if !ok {
+			return res, err
+		}
+		host, port = strings.Trim(spec.Host, "[]"), def
+	}
+
+	// DNS解析时间
+	start := time.Now()
+	ip, err := resolveIP(getConfig().Probe.network, host)
+	if err != nil {
+		return res, err
+	}
+	res.DnsTime = int(time.Since(start).Milliseconds())
+
+	// 连接时间
+	start = time.Now()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, port), monitorTimeout)
+	if err != nil {
+		return res, err
+	}
+	defer conn.Close()
+	res.ConnectTime = int(time.Since(start).Milliseconds())
+
+	conn.SetDeadline(time.Now().Add(monitorTimeout))
+	if err := starttls(spec.Type, conn); err != nil {
+		return res, fmt.Errorf("STARTTLS 失败: %w", err)
+	}
+
+	// 握手在当前线程中完成, 回调写入 cert 无需加锁
+	var cert MonitorCert
+	cfg, err := spec.tlsCheck().clientConfig(host, func(c MonitorCert) { cert = c })
+	if err != nil {
+		return res, err
+	}
+	if cfg.ServerName == "" && net.ParseIP(host) == nil {
+		cfg.ServerName = host
+	}
+	start = time.Now()
+	tlsConn := tls.Client(conn, cfg)
+	err = tlsConn.Handshake()
+	res.MonitorCert = cert
+	if err != nil {
+		return res, err
+	}
+	res.TLSTime = int(time.Since(start).Milliseconds())
+	state := tlsConn.ConnectionState()
+	res.TLSVersion = tls.VersionName(state.Version)
+	res.TLSCipher = tls.CipherSuiteName(state.CipherSuite)
+	return res, nil
+}
+
+// starttls 以明文完成 SMTP/IMAP 的问候并请求升级到 TLS, 其他类型直接返回
+func starttls(protocol string, conn net.Conn) error {
+	tp := textproto.NewConn(conn)
+	switch protocol {
+	case "smtp+starttls":
+		if _, _, err := tp.ReadResponse(220); err != nil {
+			return err
+		}
+		name, err := os.Hostname()
+		if err != nil || name == "" {
+			name = "localhost"
+		}
+		if err := tp.PrintfLine("EHLO %s", name); err != nil {
+			return err
+		}
+		_, msg, err := tp.ReadResponse(250)
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(strings.ToUpper(msg), "STARTTLS") {
+			return errors.New("服务器不支持 STARTTLS")
+		}
+		if err := tp.PrintfLine("STARTTLS"); err != nil {
+			return err
+		}
+		_, _, err = tp.ReadResponse(220)
+		return err
+
+	case "imap+starttls":
+		line, err := tp.ReadLine()
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(line, "* OK") {
+			return fmt.Errorf("意外的问候 %q", line)
+		}
+		if err := tp.PrintfLine("a1 STARTTLS"); err != nil {
+			return err
+		}
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(line, "a1 OK") {
+				return nil
+			}
+			if strings.HasPrefix(line, "a1 ") {
+				return fmt.Errorf("%s", strings.TrimPrefix(line, "a1 "))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestParseMonitorSpecsInterval(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want int
+	}{
+		{"set", `{"name":"web","host":"example.com","interval":30,"type":"http","monitor":0}`, 30},
+		{"zero", `{"name":"web","host":"example.com","interval":0,"type":"http","monitor":0}`, defaultMonitorInterval},
+		{"negative", `{"name":"web","host":"example.com","interval":-5,"type":"http","monitor":0}`, defaultMonitorInterval},
+		{"missing", `{"name":"web","host":"example.com","type":"http","monitor":0}`, defaultMonitorInterval},
+	}
+	for _, tt := range tests {
+		specs := parseMonitorSpecs("You are connecting via: IPv4\n" + tt.line + "\n")
+		if len(specs) != 1 {
+			t.Errorf("%s: %d specs, want 1", tt.name, len(specs))
+			continue
+		}
+		if specs[0].Interval != tt.want {
+			t.Errorf("%s: interval = %d, want %d", tt.name, specs[0].Interval, tt.want)
+		}
+	}
+}
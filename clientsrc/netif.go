@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 网卡类型, 由 /sys/class/net 推断, 一块网卡可以同时具有多个类型
+const (
+	ifTypeLoopback   = "loopback"
+	ifTypePhysical   = "physical"   // 有对应的硬件设备
+	ifTypeVirtual    = "virtual"    // 位于 /sys/devices/virtual 下
+	ifTypeBond       = "bond"       // 绑定网卡
+	ifTypeBondSlave  = "bond_slave" // 绑定网卡的成员, 流量已计入绑定网卡
+	ifTypeBridge     = "bridge"
+	ifTypeBridgePort = "bridge_port"
+	ifTypeVlan       = "vlan"
+	ifTypeTun        = "tun"
+)
+
+// interfaceStat /proc/net/dev 中一块网卡的累计计数
+type interfaceStat struct {
+	Name      string   `json:"name"`
+	Types     []string `json:"types"`
+	RxBytes   int64    `json:"rx_bytes"`
+	TxBytes   int64    `json:"tx_bytes"`
+	RxPackets int64    `json:"rx_packets"`
+	TxPackets int64    `json:"tx_packets"`
+	RxErrors  int64    `json:"rx_errors"`
+	TxErrors  int64    `json:"tx_errors"`
+	RxDrops   int64    `json:"rx_drops"`
+	TxDrops   int64    `json:"tx_drops"`
+}
+
+// getNetBytes 获取参与统计的网卡的累计字节数
+func getNetBytes() (rx, tx int64, err error) {
+	ifaces, err := getInterfaces()
+	for _, iface := range ifaces {
+		rx += iface.RxBytes
+		tx += iface.TxBytes
+	}
+	return rx, tx, err
+}
+
+// getInterfaces 读取 /proc/net/dev 中参与统计的网卡
+func getInterfaces() ([]interfaceStat, error) {
+	file, err := os.Open(procNetPath("dev"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	// 跳过前两行标题
+	scanner.Scan()
+	scanner.Scan()
+
+	filter := getConfig().Interfaces
+	var ifaces []interfaceStat
+	for scanner.Scan() {
+		// 网卡名与计数之间可能没有空格, 如 "eth0:123"
+		name, counters, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		parts := strings.Fields(counters)
+		if len(parts) < 16 {
+			continue
+		}
+		dev := strings.TrimSpace(name)
+		types := interfaceTypes(dev)
+		if !filter.allowed(dev, types) {
+			continue
+		}
+
+		var vals [16]int64
+		for i := range vals {
+			vals[i], _ = strconv.ParseInt(parts[i], 10, 64)
+		}
+		ifaces = append(ifaces, interfaceStat{
+			Name:      dev,
+			Types:     types,
+			RxBytes:   vals[0],
+			RxPackets: vals[1],
+			RxErrors:  vals[2],
+			RxDrops:   vals[3],
+			TxBytes:   vals[8],
+			TxPackets: vals[9],
+			TxErrors:  vals[10],
+			TxDrops:   vals[11],
+		})
+	}
+
+	return ifaces, scanner.Err()
+}
+
+// interfaceTypes 根据 /sys/class/net/<dev> 推断网卡类型
+func interfaceTypes(dev string) []string {
+	dir := sysPath("class", "net", dev)
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+
+	var types []string
+	if data, err := os.ReadFile(filepath.Join(dir, "type")); err == nil && strings.TrimSpace(string(data)) == "772" {
+		types = append(types, ifTypeLoopback)
+	}
+	if exists("device") {
+		types = append(types, ifTypePhysical)
+	} else if link, err := os.Readlink(dir); err == nil && strings.Contains(link, "/virtual/") {
+		types = append(types, ifTypeVirtual)
+	}
+	if exists("bonding") {
+		types = append(types, ifTypeBond)
+	}
+	if exists("bonding_slave") {
+		types = append(types, ifTypeBondSlave)
+	}
+	if exists("bridge") {
+		types = append(types, ifTypeBridge)
+	}
+	if exists("brport") {
+		types = append(types, ifTypeBridgePort)
+	}
+	if exists("tun_flags") {
+		types = append(types, ifTypeTun)
+	}
+	// vlan、wireguard、wlan 等由内核在 uevent 中标明
+	devtype := ueventDevtype(dir)
+	if _, err := os.Stat(procNetPath("vlan", dev)); err == nil && devtype == "" {
+		devtype = ifTypeVlan
+	}
+	if devtype != "" && !contains(types, devtype) {
+		types = append(types, devtype)
+	}
+	return types
+}
+
+// ueventDevtype 读取 uevent 中的 DEVTYPE
+func ueventDevtype(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "uevent"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if v, ok := strings.CutPrefix(line, "DEVTYPE="); ok {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// allowed 判断网卡是否参与流量统计
+// 排除规则优先; 未配置包含规则时统计除内置虚拟网卡与绑定成员以外的全部网卡
+func (f InterfaceConfig) allowed(dev string, types []string) bool {
+	if matchAny(f.Exclude, dev) || hasAnyType(f.ExcludeTypes, types) {
+		return false
+	}
+	if len(f.Include) > 0 || len(f.IncludeTypes) > 0 {
+		return matchAny(f.Include, dev) || hasAnyType(f.IncludeTypes, types)
+	}
+	return !virtRegex.MatchString(dev) && !contains(types, ifTypeBondSlave)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyType(want, types []string) bool {
+	for _, t := range want {
+		if contains(types, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny 判断名称是否匹配任一通配符
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
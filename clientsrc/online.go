@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 在线检查方式
+const (
+	onlineTypeTCP  = "tcp"  // 建立TCP连接
+	onlineTypeHTTP = "http" // 发出HTTP请求并收到任意响应
+	onlineTypeDNS  = "dns"  // 向DNS服务器查询并收到应答
+)
+
+// 默认的在线检查超时(秒)
+const defaultOnlineTimeout = 2
+
+// 未配置 online.targets 时使用的检查目标
+var defaultOnlineTargets = []OnlineTarget{
+	{Type: onlineTypeTCP, Address: "ipv4.google.com:80", Family: "ipv4"},
+	{Type: onlineTypeTCP, Address: "ipv6.google.com:80", Family: "ipv6"},
+}
+
+// validateOnline 补全并校验在线检查配置
+func validateOnline(o *OnlineConfig) error {
+	if len(o.Targets) == 0 {
+		o.Targets = append([]OnlineTarget(nil), defaultOnlineTargets...)
+	}
+	if o.Timeout == 0 {
+		o.Timeout = defaultOnlineTimeout
+	}
+	if o.Timeout < 0 {
+		return fmt.Errorf("在线检查超时不能为负数")
+	}
+
+	for i := range o.Targets {
+		t := &o.Targets[i]
+		switch t.Family {
+		case "", "ipv4", "ipv6":
+		default:
+			return fmt.Errorf("在线检查目标 %s 的地址族 %q 无效", t.Address, t.Family)
+		}
+		switch t.Type {
+		case onlineTypeTCP:
+			if _, _, err := net.SplitHostPort(t.Address); err != nil {
+				return fmt.Errorf("在线检查目标 %q 应为 host:port 格式", t.Address)
+			}
+		case onlineTypeDNS:
+			if _, _, err := net.SplitHostPort(t.Address); err != nil {
+				t.Address = net.JoinHostPort(t.Address, "53")
+			}
+			if t.Query == "" {
+				t.Query = "."
+			}
+			for _, label := range strings.Split(strings.Trim(t.Query, "."), ".") {
+				if len(label) > 63 {
+					return fmt.Errorf("在线检查目标 %s 的查询域名 %q 无效", t.Address, t.Query)
+				}
+			}
+		case onlineTypeHTTP:
+			u, err := url.Parse(t.Address)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("在线检查目标 %q 不是有效的 http(s) 地址", t.Address)
+			}
+		default:
+			return fmt.Errorf("在线检查目标 %s 的检查方式 %q 无效", t.Address, t.Type)
+		}
+	}
+	return nil
+}
+
+// supports 判断目标是否用于检查指定的IP版本
+func (t OnlineTarget) supports(version int) bool {
+	return t.Family == "" || t.Family == fmt.Sprintf("ipv%d", version)
+}
+
+// check 使用指定的IP版本检查一个目标, 成功返回 nil
+func (t OnlineTarget) check(ctx context.Context, version int) error {
+	suffix := fmt.Sprint(version) // tcp4 / tcp6 / udp4 / udp6
+	dialer := &net.Dialer{}
+
+	switch t.Type {
+	case onlineTypeTCP:
+		conn, err := dialer.DialContext(ctx, "tcp"+suffix, t.Address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+
+	case onlineTypeDNS:
+		conn, err := dialer.DialContext(ctx, "udp"+suffix, t.Address)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		return dnsQuery(ctx, conn, t.Query)
+
+	case onlineTypeHTTP:
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "tcp"+suffix, addr)
+			},
+		}
+		defer transport.CloseIdleConnections()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.Address, nil)
+		if err != nil {
+			return err
+		}
+		client := &http.Client{
+			Transport: transport,
+			// 只关心网络是否可达, 不跟随重定向
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+	return fmt.Errorf("未知的检查方式 %q", t.Type)
+}
+
+// dnsQuery 发送一个 NS 查询并等待应答
+// 只要收到ID匹配的应答(包括域名不存在等错误应答)就说明DNS服务器可达
+func dnsQuery(ctx context.Context, conn net.Conn, name string) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	var id [2]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return err
+	}
+
+	// 报头: ID, 标志(期望递归), 1个问题
+	msg := []byte{id[0], id[1], 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+	for _, label := range strings.Split(strings.Trim(name, "."), ".") {
+		if label != "" {
+			msg = append(msg, byte(len(label)))
+			msg = append(msg, label...)
+		}
+	}
+	msg = append(msg, 0, 0, 2, 0, 1) // 根标签, 类型 NS, 类 IN
+	if _, err := conn.Write(msg); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 512)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return err
+		}
+		if n >= 12 && buf[0] == id[0] && buf[1] == id[1] && buf[2]&0x80 != 0 {
+			return nil
+		}
+	}
+}
+
+// onlineResult 单个在线检查目标的结果
+type onlineResult struct {
+	Type    string  `json:"type"`
+	Address string  `json:"address"`
+	OK      bool    `json:"ok"`
+	Time    float64 `json:"time"` // 耗时(毫秒)
+	Error   string  `json:"error,omitempty"`
+}
+
+// familyHealth 单个IP版本的连通情况
+type familyHealth struct {
+	Online       bool           `json:"online"`
+	DefaultRoute bool           `json:"default_route"`
+	Addresses    []string       `json:"addresses"` // 除回环与链路本地地址以外的地址
+	Targets      []onlineResult `json:"targets"`
+}
+
+// onlineHealth 双栈连通情况, 在 extended 的 online 字段中上报
+type onlineHealth struct {
+	IPv4 familyHealth `json:"ipv4"`
+	IPv6 familyHealth `json:"ipv6"`
+}
+
+// checkOnline 并发检查适用于该IP版本的全部目标, 任一目标成功即视为在线
+func checkOnline(cfg OnlineConfig, version int) (bool, []onlineResult) {
+	ctx, cancel := context.WithTimeout(context.Background(), seconds(cfg.Timeout))
+	defer cancel()
+
+	var targets []OnlineTarget
+	for _, t := range cfg.Targets {
+		if t.supports(version) {
+			targets = append(targets, t)
+		}
+	}
+	results := make([]onlineResult, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t OnlineTarget) {
+			defer wg.Done()
+			start := time.Now()
+			err := t.check(ctx, version)
+			results[i] = onlineResult{
+				Type:    t.Type,
+				Address: t.Address,
+				OK:      err == nil,
+				Time:    round2(float64(time.Since(start).Microseconds()) / 1000),
+			}
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}(i, t)
+	}
+	wg.Wait()
+
+	online := false
+	for _, r := range results {
+		online = online || r.OK
+	}
+	return online, results
+}
+
+// checkFamily 检查一个IP版本的在线状态、默认路由与地址
+// 三者都取自客户端自身所在的网络命名空间, 即在线检查实际发出连接的位置
+func checkFamily(cfg OnlineConfig, version int) familyHealth {
+	h := familyHealth{DefaultRoute: hasDefaultRoute(version)}
+	h.Online, h.Targets = checkOnline(cfg, version)
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return h
+	}
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || !ipnet.IP.IsGlobalUnicast() || (ipnet.IP.To4() != nil) != (version == 4) {
+			continue
+		}
+		h.Addresses = append(h.Addresses, ipnet.IP.String())
+	}
+	return h
+}
+
+// 路由标志, 见 linux/route.h
+const (
+	rtfUp     = 0x0001
+	rtfReject = 0x0200
+)
+
+// hasDefaultRoute 读取 route 或 ipv6_route 判断是否存在可用的默认路由
+// 内核总会在 lo 上列出一条 ::/0 的拒绝路由, 因此跳过 lo 以及未启用或拒绝类型的路由.
+// 与在线检查和地址一样读取客户端自身所在的网络命名空间, 不读取 -procfs 下宿主机的路由表
+func hasDefaultRoute(version int) bool {
+	// 各列的位置: 网卡, 目的地址, 前缀长度(IPv4 为掩码), 标志
+	name, iface, dst, prefix, flags := "route", 0, 1, 7, 3
+	if version == 6 {
+		name, iface, dst, prefix, flags = "ipv6_route", 9, 0, 1, 8
+	}
+	f, err := os.Open(filepath.Join(defaultProcfs, "net", name))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) <= iface || fields[iface] == "lo" {
+			continue
+		}
+		if strings.Trim(fields[dst], "0") != "" || strings.Trim(fields[prefix], "0") != "" {
+			continue
+		}
+		fl, err := strconv.ParseUint(fields[flags], 16, 32)
+		if err == nil && fl&rtfUp != 0 && fl&rtfReject == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// onlineMonitor 在线状态检查, 按 online 周期或在重新连接后检查一次
+// 两个IP版本分别独立检查, 与连接服务器使用的IP版本无关
+func onlineMonitor(ctx context.Context, cfg *Config) {
+	for {
+		var health onlineHealth
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			health.IPv4 = checkFamily(cfg.Online, 4)
+		}()
+		go func() {
+			defer wg.Done()
+			health.IPv6 = checkFamily(cfg.Online, 6)
+		}()
+		wg.Wait()
+
+		sampled.Lock()
+		sampled.online4, sampled.online6 = health.IPv4.Online, health.IPv6.Online
+		sampled.online = &health
+		sampled.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-onlineTrigger:
+		case <-time.After(cfg.period("online")):
+		}
+	}
+}
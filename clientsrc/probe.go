@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 探测方式
+const (
+	probeTypeTCP  = "tcp"  // TCP 连接耗时
+	probeTypeICMP = "icmp" // ICMP 回显
+)
+
+// 默认的探测超时(秒)
+const defaultProbeTimeout = 1
+
+// probeResult 单个探测目标的最新结果
+type probeResult struct {
+	Name string `json:"name"`
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	Type string `json:"type"`
+	probeStat
+}
+
+// probeStat 最近 PingPacketHistoryLen 次探测的统计, 延迟单位为毫秒, 只统计成功的探测
+type probeStat struct {
+	RTT        float64 `json:"rtt"` // 最近一次成功探测的延迟
+	Min        float64 `json:"min"`
+	Avg        float64 `json:"avg"`
+	Max        float64 `json:"max"`
+	Jitter     float64 `json:"jitter"` // 延迟的标准差
+	P50        float64 `json:"p50"`
+	P95        float64 `json:"p95"`
+	P99        float64 `json:"p99"`
+	Loss       float64 `json:"loss"`        // 丢包率(%)
+	LossStreak int     `json:"loss_streak"` // 最长连续丢包次数
+	Samples    int     `json:"samples"`
+	Updated    int64   `json:"updated"`  // 最近一次探测的 Unix 时间
+	Interval   float64 `json:"interval"` // 到下一次探测的间隔(秒)
+}
+
+// probeSample 单次探测结果, 丢包时 rtt 为0
+type probeSample struct {
+	rtt  time.Duration
+	lost bool
+}
+
+// period 返回目标的探测周期, 未设置时使用 ping 采样周期
+func (t ProbeTarget) period(def time.Duration) time.Duration {
+	if t.Interval > 0 {
+		return seconds(t.Interval)
+	}
+	return def
+}
+
+// protoNetwork 将协议偏好换算为 net 包的网络类型
+func protoNetwork(proto string) string {
+	switch strings.ToLower(proto) {
+	case "ipv4":
+		return "ip4"
+	case "ipv6":
+		return "ip6"
+	default:
+		return "ip"
+	}
+}
+
+// validateProbe 补全并校验探测目标
+// 未配置 targets 时由 CU/CT/CM 生成三个目标; 未配置 legacy 时前三个目标依次上报到 CU/CT/CM 字段
+func validateProbe(p *ProbeConfig) error {
+	p.network = protoNetwork(p.Proto)
+	if p.Type == "" {
+		p.Type = probeTypeTCP
+	}
+	if p.Timeout == 0 {
+		p.Timeout = defaultProbeTimeout
+	}
+	if len(p.Targets) == 0 {
+		p.Targets = []ProbeTarget{
+			{Name: "CU", Host: p.CU},
+			{Name: "CT", Host: p.CT},
+			{Name: "CM", Host: p.CM},
+		}
+	}
+
+	names := make(map[string]struct{}, len(p.Targets))
+	for i := range p.Targets {
+		t := &p.Targets[i]
+		if t.Name == "" || t.Host == "" {
+			return fmt.Errorf("第%d个探测目标缺少名称或主机", i+1)
+		}
+		if _, ok := names[t.Name]; ok {
+			return fmt.Errorf("探测目标名称 %q 重复", t.Name)
+		}
+		names[t.Name] = struct{}{}
+		if t.Port == 0 {
+			t.Port = p.Port
+		}
+		if t.Port < 1 || t.Port > 65535 {
+			return fmt.Errorf("探测目标 %s 的端口号必须在1到65535之间", t.Name)
+		}
+		if t.Proto == "" {
+			t.Proto = p.Proto
+		}
+		if t.Interval < 0 {
+			return fmt.Errorf("探测目标 %s 的周期不能为负数", t.Name)
+		}
+		if t.Type == "" {
+			t.Type = p.Type
+		}
+		if t.Type != probeTypeTCP && t.Type != probeTypeICMP {
+			return fmt.Errorf("探测目标 %s 的探测方式 %q 无效", t.Name, t.Type)
+		}
+		if t.Timeout == 0 {
+			t.Timeout = p.Timeout
+		}
+		if t.Timeout <= 0 {
+			return fmt.Errorf("探测目标 %s 的超时时间必须大于0", t.Name)
+		}
+		if t.Schedule.Jitter == 0 {
+			t.Schedule.Jitter = p.Schedule.Jitter
+		}
+		if t.Schedule.FailureInterval == 0 {
+			t.Schedule.FailureInterval = p.Schedule.FailureInterval
+		}
+		if err := t.Schedule.validate(); err != nil {
+			return fmt.Errorf("探测目标 %s 的%w", t.Name, err)
+		}
+		t.network = protoNetwork(t.Proto)
+	}
+
+	legacy := []*string{&p.Legacy.CU, &p.Legacy.CT, &p.Legacy.CM}
+	if p.Legacy == (ProbeLegacy{}) {
+		for i := range legacy {
+			if i < len(p.Targets) {
+				*legacy[i] = p.Targets[i].Name
+			}
+		}
+	}
+	for _, name := range legacy {
+		if _, ok := names[*name]; !ok && *name != "" {
+			return fmt.Errorf("probe.legacy 中的探测目标 %q 不存在", *name)
+		}
+	}
+	return nil
+}
+
+// probeRunner 按目标的探测方式执行单次探测
+type probeRunner struct {
+	target  ProbeTarget
+	timeout time.Duration
+	pinger  *icmpPinger
+	failed  bool // 已记录打开 ICMP 套接字失败的日志, 恢复前不再重复记录
+}
+
+// probe 探测一次, 超时或失败均返回错误, 计为丢包
+func (r *probeRunner) probe(ip string) (time.Duration, error) {
+	if r.target.Type != probeTypeICMP {
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, strconv.Itoa(r.target.Port)), r.timeout)
+		if err != nil {
+			return 0, err
+		}
+		conn.Close()
+		return time.Since(start), nil
+	}
+
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return 0, fmt.Errorf("无效的IP地址 %q", ip)
+	}
+	ipv6 := addr.To4() == nil
+	if r.pinger != nil && r.pinger.ipv6 != ipv6 {
+		r.close()
+	}
+	if r.pinger == nil {
+		pinger, err := newICMPPinger(ipv6)
+		if err != nil {
+			if !r.failed {
+				log.Printf("PingWorker %s: %v\n", r.target.Name, err)
+				r.failed = true
+			}
+			return 0, err
+		}
+		r.pinger, r.failed = pinger, false
+	}
+	return r.pinger.ping(addr, r.timeout)
+}
+
+func (r *probeRunner) close() {
+	if r.pinger != nil {
+		r.pinger.Close()
+		r.pinger = nil
+	}
+}
+
+// validate 校验调度参数
+func (s ProbeSchedule) validate() error {
+	if s.Jitter < 0 || s.FailureInterval < 0 {
+		return fmt.Errorf("调度参数不能为负数")
+	}
+	return nil
+}
+
+// pingWorker 单个目标的延迟监测工作线程, 超时与失败计为丢包, 不计入延迟统计
+// 按 probeScheduler 调度, 相邻两次探测的开始时间间隔固定, 不受探测耗时影响
+func pingWorker(ctx context.Context, target ProbeTarget, period time.Duration) {
+	window := make([]probeSample, 0, PingPacketHistoryLen)
+	mark := target.Name
+	sched := newProbeScheduler(period, target.Schedule)
+	runner := &probeRunner{target: target, timeout: seconds(target.Timeout)}
+	defer runner.close()
+
+	if !sleepContext(ctx, sched.initialDelay()) {
+		return
+	}
+	for {
+		start := time.Now()
+		// 解析IP（优先指定协议）
+		ip, err := resolveIP(target.network, target.Host)
+		if err != nil {
+			log.Printf("PingWorker %s: 解析IP失败: %v\n", mark, err)
+			ip = target.Host // 解析失败直接使用主机名
+		}
+
+		// 维护滑动窗口
+		if len(window) >= PingPacketHistoryLen {
+			window = window[1:]
+		}
+
+		// 执行探测
+		rtt, err := runner.probe(ip)
+		window = append(window, probeSample{rtt: rtt, lost: err != nil})
+		wait := sched.next(err != nil)
+		stat := newProbeStat(window)
+		stat.Updated = start.Unix()
+		stat.Interval = round2(wait.Seconds())
+		probeStats.Store(mark, stat)
+
+		if !sleepContext(ctx, time.Until(start.Add(wait))) {
+			return
+		}
+	}
+}
+
+// newProbeStat 计算窗口内的延迟统计
+// 丢包率在窗口过半后才开始计算, 避免启动时少量样本造成误报
+func newProbeStat(window []probeSample) probeStat {
+	stat := probeStat{Samples: len(window)}
+	var rtts []float64
+	lost, streak := 0, 0
+	for _, sample := range window {
+		if sample.lost {
+			lost++
+			streak++
+			stat.LossStreak = max(stat.LossStreak, streak)
+			continue
+		}
+		streak = 0
+		rtts = append(rtts, float64(sample.rtt.Microseconds())/1000)
+	}
+	if len(window) > PingPacketHistoryLen/2 {
+		stat.Loss = round2(float64(lost) / float64(len(window)) * 100)
+	}
+	if len(rtts) == 0 {
+		return stat
+	}
+
+	for i := len(window) - 1; i >= 0; i-- {
+		if !window[i].lost {
+			stat.RTT = round2(float64(window[i].rtt.Microseconds()) / 1000)
+			break
+		}
+	}
+	var sum float64
+	for _, rtt := range rtts {
+		sum += rtt
+	}
+	avg := sum / float64(len(rtts))
+	var variance float64
+	for _, rtt := range rtts {
+		variance += (rtt - avg) * (rtt - avg)
+	}
+	sort.Float64s(rtts)
+	stat.Min = round2(rtts[0])
+	stat.Max = round2(rtts[len(rtts)-1])
+	stat.Avg = round2(avg)
+	stat.Jitter = round2(math.Sqrt(variance / float64(len(rtts))))
+	stat.P50 = round2(percentile(rtts, 50))
+	stat.P95 = round2(percentile(rtts, 95))
+	stat.P99 = round2(percentile(rtts, 99))
+	return stat
+}
+
+// percentile 最近秩法计算百分位数, sorted 须已升序排列且非空
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+// resolveIP 按网络类型(ip4/ip6/ip)解析IP
+func resolveIP(network, host string) (string, error) {
+	if strings.Contains(host, ":") || net.ParseIP(host) != nil {
+		return host, nil // 已为IP地址, 不受IP版本偏好限制
+	}
+
+	ipAddr, err := net.ResolveIPAddr(network, host)
+	if err != nil {
+		return "", err
+	}
+	return ipAddr.IP.String(), nil
+}
+
+// probeResults 按配置顺序返回各探测目标的最新结果
+func probeResults(cfg *Config) []probeResult {
+	results := make([]probeResult, len(cfg.Probe.Targets))
+	for i, t := range cfg.Probe.Targets {
+		results[i] = probeResult{Name: t.Name, Host: t.Host, Port: t.Port, Type: t.Type}
+		if val, ok := probeStats.Load(t.Name); ok {
+			results[i].probeStat = val.(probeStat)
+		}
+	}
+	return results
+}
+
+// legacyProbe 返回上报到服务器原有字段的丢包率与最近一次的延迟(毫秒), 未指定目标时为0
+func legacyProbe(results []probeResult, name string) (float64, int) {
+	for _, r := range results {
+		if r.Name == name {
+			return r.Loss, int(math.Round(r.RTT))
+		}
+	}
+	return 0, 0
+}
+
+// customProbe 在 custom 字段中逐行展示全部探测目标, 格式与自定义监控数据一致
+func customProbe() string {
+	results := probeResults(getConfig())
+	if len(results) == 0 {
+		return ""
+	}
+
+	parts := make([]string, len(results))
+	for i, r := range results {
+		// 丢包率后的括号内为最长连续丢包次数
+		parts[i] = fmt.Sprintf("%s\\t平均: %.1f\\tP95: %.1f\\t抖动: %.1f\\t丢包: %.1f%%(%d)",
+			html.EscapeString(r.Name), r.Avg, r.P95, r.Jitter, r.Loss, r.LossStreak)
+	}
+	return strings.Join(parts, "<br>")
+}
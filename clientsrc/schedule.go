@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// minPeriod 采样与发送周期的下限, 防止过小的间隔使线程空转
+const minPeriod = 100 * time.Millisecond
+
+// 可在配置文件 periods 中单独设置周期的采样线程, 未设置时使用 interval
+// online 例外, 未设置时默认每150秒检查一次
+var periodNames = map[string]float64{
+	"ping":     0,
+	"netspeed": 0,
+	"diskio":   0,
+	"cpu":      0,
+	"memory":   0,
+	"load":     0,
+	"disk":     0,
+	"process":  0,
+	"traffic":  0,
+	"online":   150,
+}
+
+// seconds 将以秒为单位的浮点数换算为 time.Duration
+// 保留小数部分, 并且不小于 minPeriod
+func seconds(sec float64) time.Duration {
+	d := time.Duration(math.Round(sec * float64(time.Second)))
+	if d < minPeriod {
+		return minPeriod
+	}
+	return d
+}
+
+// period 返回指定采样线程的周期
+func (cfg *Config) period(name string) time.Duration {
+	if sec := cfg.Periods[name]; sec > 0 {
+		return seconds(sec)
+	}
+	if sec := periodNames[name]; sec > 0 {
+		return seconds(sec)
+	}
+	return seconds(cfg.Interval)
+}
+
+// runEvery 立即执行一次 fn, 之后按固定周期重复执行, 直至 ctx 被取消
+// 节拍由 Ticker 维持, fn 的耗时不会累积成漂移; fn 耗时超过周期时跳过错过的节拍
+func runEvery(ctx context.Context, period time.Duration, fn func()) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		fn()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probeScheduler 探测线程的调度
+// 默认按固定周期探测; 设置 jitter 后每次间隔在周期上下随机浮动, 避免多个探测同时发出;
+// 设置 failure_interval 后探测失败时改用较短的周期, 直到再次成功
+type probeScheduler struct {
+	period  time.Duration
+	jitter  time.Duration
+	failure time.Duration
+}
+
+func newProbeScheduler(period time.Duration, s ProbeSchedule) probeScheduler {
+	sched := probeScheduler{
+		period: period,
+		jitter: time.Duration(s.Jitter * float64(time.Second)),
+	}
+	if s.FailureInterval > 0 {
+		sched.failure = seconds(s.FailureInterval)
+	}
+	return sched
+}
+
+// initialDelay 首次探测前的等待时间, 设置了 jitter 时在 [0, jitter) 内随机
+func (s probeScheduler) initialDelay() time.Duration {
+	if s.jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(s.jitter)))
+}
+
+// next 返回从本次探测开始到下一次探测开始的间隔
+func (s probeScheduler) next(failed bool) time.Duration {
+	d := s.period
+	if failed && s.failure > 0 && s.failure < d {
+		d = s.failure
+	}
+	if s.jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(2*s.jitter))) - s.jitter
+	}
+	return max(d, minPeriod)
+}
+
+// sleepContext 休眠指定时长, ctx 被取消时提前返回 false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// backgroundMonitor 后台监控线程组
+// key 返回该组依赖的配置指纹, 重新加载配置后指纹变化的线程组才会被重启
+type backgroundMonitor struct {
+	name   string
+	key    func(cfg *Config) string
+	run    func(ctx context.Context, cfg *Config)
+	cancel context.CancelFunc
+	last   string
+}
+
+// 启动所有后台监控线程
+func startBackgroundMonitors(cfg *Config) {
+	for _, m := range backgroundMonitors {
+		m.start(cfg)
+	}
+}
+
+// reloadBackgroundMonitors 重启配置发生变化的后台监控线程
+func reloadBackgroundMonitors(cfg *Config) {
+	for _, m := range backgroundMonitors {
+		if m.key(cfg) == m.last {
+			continue
+		}
+		log.Printf("配置变化, 重启 %s 监控\n", m.name)
+		m.cancel()
+		m.start(cfg)
+	}
+}
+
+func (m *backgroundMonitor) start(cfg *Config) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.last = m.key(cfg)
+	m.run(ctx, cfg)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"time"
+)
+
+// 未配置 tls.expiry_days 时标出证书即将过期的天数
+const defaultExpiryDays = 14
+
+// tls.min_version 可选的版本
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// MonitorCert 对端证书信息, 只有基于 TLS 的监控才有值
+type MonitorCert struct {
+	CertDays   int      `json:"cert_days"` // 叶子证书的剩余有效天数, 已过期时为负数
+	CertIssuer string   `json:"cert_issuer,omitempty"`
+	CertSANs   []string `json:"cert_sans,omitempty"`
+	CertValid  bool     `json:"cert_valid"` // 证书链与主机名校验通过, insecure 时也会校验
+}
+
+// newMonitorCert 提取叶子证书的有效期、签发者与备用名称
+func newMonitorCert(leaf *x509.Certificate) MonitorCert {
+	cert := MonitorCert{
+		CertDays:   int(math.Floor(time.Until(leaf.NotAfter).Hours() / 24)),
+		CertIssuer: leaf.Issuer.String(),
+		CertSANs:   append([]string(nil), leaf.DNSNames...),
+	}
+	for _, ip := range leaf.IPAddresses {
+		cert.CertSANs = append(cert.CertSANs, ip.String())
+	}
+	return cert
+}
+
+// validate 校验 tls 检查选项, 证书文件在每次检查时读取
+func (c *TLSCheck) validate() error {
+	if _, ok := tlsVersions[c.MinVersion]; !ok && c.MinVersion != "" {
+		return fmt.Errorf("TLS 最低版本 %q 无效", c.MinVersion)
+	}
+	if (c.Cert == "") != (c.Key == "") {
+		return fmt.Errorf("客户端证书与私钥须同时设置")
+	}
+	if c.ExpiryDays < 0 {
+		return fmt.Errorf("证书过期提醒天数不能为负数")
+	}
+	return nil
+}
+
+// expiryDays 返回标出证书即将过期的天数
+func (c *TLSCheck) expiryDays() int {
+	if c == nil || c.ExpiryDays == 0 {
+		return defaultExpiryDays
+	}
+	return c.ExpiryDays
+}
+
+// clientConfig 按校验规则生成 TLS 客户端配置
+// 证书链在 VerifyConnection 中自行校验, 这样校验失败时 onCert 也能收到证书信息;
+// onCert 在握手线程中调用. 未设置 server_name 时 ServerName 留空, 由调用方按连接的主机填写,
+// 连接IP地址时不发送 SNI, 以 host 校验证书
+func (c *TLSCheck) clientConfig(host string, onCert func(MonitorCert)) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: true,
+		MinVersion:         tlsVersions[c.MinVersion],
+	}
+
+	var roots *x509.CertPool // 为 nil 时使用系统根证书
+	if c.CA != "" {
+		data, err := os.ReadFile(c.CA)
+		if err != nil {
+			return nil, fmt.Errorf("读取 CA 证书失败: %w", err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("%s 中没有有效的 CA 证书", c.CA)
+		}
+	}
+	if c.Cert != "" {
+		pair, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+		if err != nil {
+			return nil, fmt.Errorf("读取客户端证书失败: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("对端未提供证书")
+		}
+		name := cs.ServerName
+		if name == "" {
+			name = host
+		}
+		opts := x509.VerifyOptions{
+			Roots:         roots,
+			DNSName:       name,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := cs.PeerCertificates[0].Verify(opts)
+		cert := newMonitorCert(cs.PeerCertificates[0])
+		cert.CertValid = err == nil
+		onCert(cert)
+		if c.Insecure {
+			return nil
+		}
+		return err
+	}
+	return cfg, nil
+}
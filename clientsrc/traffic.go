@@ -0,0 +1,202 @@
+package main
+
+import (
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 默认每60秒保存一次流量状态文件
+const defaultTrafficSaveInterval = 60
+
+// trafficState 持久化的累计流量
+// 保存各网卡上次读到的原始计数与累计值, 客户端重启后可继续累计, 重启系统或计数器归零时不会丢失已统计的流量
+type trafficState struct {
+	BootID     string                     `json:"boot_id"`
+	Uptime     uint64                     `json:"uptime"` // 上次读数时的系统运行时间(秒)
+	Interfaces map[string]*trafficCounter `json:"interfaces"`
+	Ledger     trafficLedger              `json:"ledger"`
+}
+
+// trafficCounter 单个网卡的累计流量(字节)
+type trafficCounter struct {
+	Ifindex int    `json:"ifindex"`
+	LastRx  uint64 `json:"last_rx"`
+	LastTx  uint64 `json:"last_tx"`
+	TotalRx uint64 `json:"total_rx"`
+	TotalTx uint64 `json:"total_tx"`
+}
+
+// trafficCounters 将 /proc/net/dev 的原始计数换算为单调递增的累计流量
+type trafficCounters struct {
+	file     string
+	interval time.Duration
+	resetDay int
+	state    trafficState
+	saved    time.Time
+}
+
+// newTrafficCounters 读取状态文件, 文件不存在时从零开始累计
+func newTrafficCounters(cfg TrafficConfig) *trafficCounters {
+	interval := seconds(defaultTrafficSaveInterval)
+	if cfg.SaveInterval > 0 {
+		interval = seconds(cfg.SaveInterval)
+	}
+	c := &trafficCounters{
+		file:     cfg.StateFile,
+		interval: interval,
+		resetDay: cfg.ResetDay,
+		saved:    time.Now(),
+	}
+	data, err := os.ReadFile(c.file)
+	if err == nil {
+		err = json.Unmarshal(data, &c.state)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Println("读取流量状态文件失败, 从零开始累计:", err)
+	}
+	if c.state.Interfaces == nil {
+		c.state.Interfaces = make(map[string]*trafficCounter)
+	}
+	return c
+}
+
+// update 用本次读数更新累计值与账本, 返回自上次读数以来新增的流量
+func (c *trafficCounters) update(ifaces []interfaceStat) (rx, tx uint64) {
+	bootID, uptime := getBootID(), getUptime()
+	rebooted := c.state.rebooted(bootID, uptime)
+	c.state.BootID, c.state.Uptime = bootID, uptime
+
+	for _, iface := range ifaces {
+		ifindex := getIfindex(iface.Name)
+		curRx, curTx := uint64(iface.RxBytes), uint64(iface.TxBytes)
+		counter, ok := c.state.Interfaces[iface.Name]
+		if !ok {
+			// 首次出现的网卡从当前读数开始累计
+			c.state.Interfaces[iface.Name] = &trafficCounter{Ifindex: ifindex, LastRx: curRx, LastTx: curTx}
+			continue
+		}
+
+		// 系统重启或网卡被重建后计数器从零开始, 本次读数即为新增流量
+		recreated := rebooted || counter.Ifindex != ifindex
+		deltaRx := counterDelta(counter.LastRx, curRx, recreated)
+		deltaTx := counterDelta(counter.LastTx, curTx, recreated)
+		counter.TotalRx += deltaRx
+		counter.TotalTx += deltaTx
+		counter.LastRx, counter.LastTx = curRx, curTx
+		counter.Ifindex = ifindex
+		rx += deltaRx
+		tx += deltaTx
+	}
+	c.state.Ledger.add(time.Now(), c.resetDay, rx, tx)
+
+	if time.Since(c.saved) >= c.interval {
+		if err := c.save(); err != nil {
+			log.Println("保存流量状态文件失败:", err)
+		}
+		c.saved = time.Now()
+	}
+	return rx, tx
+}
+
+// totals 返回全部网卡(包括已消失的网卡)的累计流量
+func (c *trafficCounters) totals() (rx, tx uint64) {
+	for _, counter := range c.state.Interfaces {
+		rx += counter.TotalRx
+		tx += counter.TotalTx
+	}
+	return rx, tx
+}
+
+// save 先写临时文件再重命名, 避免断电时留下不完整的状态文件
+func (c *trafficCounters) save() error {
+	data, err := json.Marshal(c.state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.file), 0o755); err != nil {
+		return err
+	}
+	tmp := c.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.file)
+}
+
+// counterWrapMargin 视为 32 位计数器回绕时两次读数之间允许的最大增量
+const counterWrapMargin = 1 << 30
+
+// counterDelta 计算计数器的增量
+// 计数器变小时, 只有上次读数接近 32 位上限、按回绕计算的增量不超过 counterWrapMargin 时才视为回绕,
+// 否则视为计数器被重置, 避免 64 位计数器归零时多计约 4GiB
+func counterDelta(last, cur uint64, reset bool) uint64 {
+	switch {
+	case reset:
+		return cur
+	case cur >= last:
+		return cur - last
+	case last <= math.MaxUint32 && math.MaxUint32-last+cur+1 <= counterWrapMargin:
+		return math.MaxUint32 - last + cur + 1
+	default:
+		return cur
+	}
+}
+
+// rebooted 判断上次读数之后系统是否重启过
+// 不使用 /proc/stat 的 btime: 它由当前时间减去运行时间得出, 没有 RTC 的设备开机后校时会使其跳变;
+// 优先比较 boot_id, 读不到时以运行时间变小判断
+func (s *trafficState) rebooted(bootID string, uptime uint64) bool {
+	if bootID != "" && s.BootID != "" {
+		return bootID != s.BootID
+	}
+	return uptime > 0 && uptime < s.Uptime
+}
+
+// getBootID 读取每次启动时随机生成的 boot_id
+func getBootID() string {
+	data, err := os.ReadFile(procPath("sys", "kernel", "random", "boot_id"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// getIfindex 读取网卡序号, 网卡被删除后重建时序号会变化
+func getIfindex(dev string) int {
+	data, err := os.ReadFile(sysPath("class", "net", dev, "ifindex"))
+	if err != nil {
+		return 0
+	}
+	ifindex, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return ifindex
+}
+
+// persistentTrafficSample 以状态文件累计流量
+// network_in/network_out 默认上报单调递增的累计值, cycle 模式下上报当前账期的流量
+func persistentTrafficSample(cfg *Config) func() {
+	counters := newTrafficCounters(cfg.Traffic)
+
+	return func() {
+		ifaces, err := getInterfaces()
+		if err != nil {
+			log.Println("流量统计错误:", err)
+			return
+		}
+		counters.update(ifaces)
+		usage := counters.state.Ledger.usage(time.Now(), cfg.Traffic)
+		netIn, netOut := counters.totals()
+		if cfg.Traffic.Mode == trafficModeCycle {
+			netIn, netOut = usage.Cycle.Rx, usage.Cycle.Tx
+		}
+
+		sampled.Lock()
+		sampled.netIn, sampled.netOut = netIn, netOut
+		sampled.traffic = &usage
+		sampled.Unlock()
+	}
+}
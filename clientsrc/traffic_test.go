@@ -0,0 +1,175 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCounterDelta(t *testing.T) {
+	tests := []struct {
+		name      string
+		last, cur uint64
+		reset     bool
+		want      uint64
+	}{
+		{"increase", 100, 250, false, 150},
+		{"unchanged", 100, 100, false, 0},
+		{"32-bit wrap", math.MaxUint32 - 99, 50, false, 150},
+		{"wrap at limit", math.MaxUint32, 0, false, 1},
+		{"reset below 4GiB", 3 << 30, 1000, false, 1000},
+		{"reset of small counter", 5000, 10, false, 10},
+		{"reset of 64-bit counter", 10 << 30, 1000, false, 1000},
+		{"reboot", 5000, 6000, true, 6000},
+	}
+	for _, tt := range tests {
+		if got := counterDelta(tt.last, tt.cur, tt.reset); got != tt.want {
+			t.Errorf("%s: counterDelta(%d, %d, %v) = %d, want %d", tt.name, tt.last, tt.cur, tt.reset, got, tt.want)
+		}
+	}
+}
+
+func TestTrafficStateRebooted(t *testing.T) {
+	tests := []struct {
+		name   string
+		state  trafficState
+		bootID string
+		uptime uint64
+		want   bool
+	}{
+		{"same boot, clock stepped", trafficState{BootID: "a", Uptime: 100}, "a", 160, false},
+		{"new boot id", trafficState{BootID: "a", Uptime: 100}, "b", 5000, true},
+		{"no boot id, uptime dropped", trafficState{Uptime: 100}, "", 20, true},
+		{"no boot id, uptime grew", trafficState{Uptime: 100}, "", 200, false},
+		{"old state file", trafficState{}, "a", 20, false},
+	}
+	for _, tt := range tests {
+		if got := tt.state.rebooted(tt.bootID, tt.uptime); got != tt.want {
+			t.Errorf("%s: rebooted = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCycleStart(t *testing.T) {
+	tests := []struct {
+		now      string
+		resetDay int
+		want     string
+	}{
+		{"2024-03-16", 1, "2024-03-01"},
+		{"2024-03-01", 1, "2024-03-01"},
+		{"2024-03-14", 15, "2024-02-15"},
+		{"2024-03-15", 15, "2024-03-15"},
+		{"2024-01-10", 28, "2023-12-28"},
+		{"2024-02-29", 28, "2024-02-28"},
+		{"2024-03-27", 28, "2024-02-28"},
+	}
+	for _, tt := range tests {
+		now, _ := time.ParseInLocation("2006-01-02", tt.now, time.Local)
+		if got := cycleStart(now.Add(12*time.Hour), tt.resetDay).Format("2006-01-02"); got != tt.want {
+			t.Errorf("cycleStart(%s, %d) = %s, want %s", tt.now, tt.resetDay, got, tt.want)
+		}
+	}
+}
+
+func TestTrafficLedgerAdd(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		return d
+	}
+	type add struct {
+		at       string
+		resetDay int
+		rx, tx   uint64
+	}
+	tests := []struct {
+		name   string
+		adds   []add
+		cycles []trafficBucket
+		days   int
+		months int
+	}{
+		{
+			name: "same cycle",
+			adds: []add{
+				{"2024-03-10 08:00", 1, 10, 1},
+				{"2024-03-10 09:00", 1, 20, 2},
+				{"2024-03-11 09:00", 1, 30, 3},
+			},
+			cycles: []trafficBucket{{"2024-03-01", 60, 6}},
+			days:   2, months: 1,
+		},
+		{
+			name: "rollover at reset day",
+			adds: []add{
+				{"2024-03-14 23:59", 15, 10, 1},
+				{"2024-03-15 00:00", 15, 20, 2},
+			},
+			cycles: []trafficBucket{{"2024-02-15", 10, 1}, {"2024-03-15", 20, 2}},
+			days:   2, months: 1,
+		},
+		{
+			name: "rollover across year and month",
+			adds: []add{
+				{"2023-12-31 12:00", 1, 10, 1},
+				{"2024-01-01 12:00", 1, 20, 2},
+			},
+			cycles: []trafficBucket{{"2023-12-01", 10, 1}, {"2024-01-01", 20, 2}},
+			days:   2, months: 2,
+		},
+		{
+			// 重置日从1改为10: 新账期从 3月10日开始, 由日账本补齐
+			name: "reset day moved later",
+			adds: []add{
+				{"2024-03-05 12:00", 1, 10, 1},
+				{"2024-03-12 12:00", 1, 20, 2},
+				{"2024-03-13 12:00", 10, 40, 4},
+			},
+			cycles: []trafficBucket{{"2024-03-01", 30, 3}, {"2024-03-10", 60, 6}},
+			days:   3, months: 1,
+		},
+		{
+			// 重置日从20改为5: 与新账期重叠的旧账期被去掉
+			name: "reset day moved earlier",
+			adds: []add{
+				{"2024-03-21 12:00", 20, 10, 1},
+				{"2024-03-22 12:00", 5, 20, 2},
+			},
+			cycles: []trafficBucket{{"2024-03-05", 30, 3}},
+			days:   2, months: 1,
+		},
+	}
+	for _, tt := range tests {
+		var l trafficLedger
+		for _, a := range tt.adds {
+			l.add(day(a.at), a.resetDay, a.rx, a.tx)
+		}
+		if len(l.Cycles) != len(tt.cycles) {
+			t.Errorf("%s: cycles = %v, want %v", tt.name, l.Cycles, tt.cycles)
+			continue
+		}
+		for i := range tt.cycles {
+			if l.Cycles[i] != tt.cycles[i] {
+				t.Errorf("%s: cycles = %v, want %v", tt.name, l.Cycles, tt.cycles)
+				break
+			}
+		}
+		if len(l.Days) != tt.days || len(l.Months) != tt.months {
+			t.Errorf("%s: %d days, %d months, want %d, %d", tt.name, len(l.Days), len(l.Months), tt.days, tt.months)
+		}
+	}
+}
+
+func TestTrafficLedgerKeep(t *testing.T) {
+	var l trafficLedger
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.Local)
+	for i := 0; i < 1000; i++ {
+		l.add(start.AddDate(0, 0, i), 1, 1, 1)
+	}
+	if len(l.Days) != ledgerKeepDays || len(l.Months) != ledgerKeepMonths || len(l.Cycles) != ledgerKeepCycles {
+		t.Errorf("kept %d days, %d months, %d cycles", len(l.Days), len(l.Months), len(l.Cycles))
+	}
+	if last := l.Days[len(l.Days)-1].Start; last != start.AddDate(0, 0, 999).Format("2006-01-02") {
+		t.Errorf("last day = %s", last)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// /proc/net/tcp 中的连接状态编码
+var tcpStateNames = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+	"0C": "NEW_SYN_RECV",
+}
+
+// ss 默认不显示的TCP状态, 统计连接数时同样排除
+var tcpHiddenStates = map[string]bool{
+	"03": true, // SYN_RECV
+	"06": true, // TIME_WAIT
+	"07": true, // CLOSE
+	"0A": true, // LISTEN
+}
+
+// UDP 未连接(UNCONN) 状态, 即 ss 中的监听套接字
+const udpListenState = "07"
+
+// getTupd 读取 /proc 统计TCP/UDP连接数与进程/线程数
+// 连接数与 ss -t / ss -u 的默认输出一致, tcpStates 则包含全部状态
+func getTupd() (tcp, udp, process, thread int, tcpStates map[string]int) {
+	tcpStates = make(map[string]int)
+	for _, name := range []string{"tcp", "tcp6"} {
+		countSockets(procNetPath(name), func(state string) {
+			tcpStates[tcpStateName(state)]++
+			if !tcpHiddenStates[state] {
+				tcp++
+			}
+		})
+	}
+	for _, name := range []string{"udp", "udp6"} {
+		countSockets(procNetPath(name), func(state string) {
+			if state != udpListenState {
+				udp++
+			}
+		})
+	}
+
+	process, thread = countProcesses()
+	return tcp, udp, process, thread, tcpStates
+}
+
+// countSockets 遍历 /proc/net/{tcp,udp}[6] 中的套接字, 对每条记录的状态调用 fn
+// 文件不存在(如未启用IPv6)时直接忽略
+func countSockets(file string, fn func(state string)) {
+	f, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // 跳过标题
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		fn(strings.ToUpper(fields[3]))
+	}
+}
+
+func tcpStateName(state string) string {
+	if name, ok := tcpStateNames[state]; ok {
+		return name
+	}
+	return state
+}
+
+// countProcesses 统计 /proc 下的进程数, 并累加各进程 status 中的 Threads 得到线程数
+func countProcesses() (process, thread int) {
+	entries, err := os.ReadDir(procPath())
+	if err != nil {
+		return 0, 0
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !isPid(entry.Name()) {
+			continue
+		}
+		data, err := os.ReadFile(procPath(entry.Name(), "status"))
+		if err != nil {
+			// 进程已退出
+			continue
+		}
+		process++
+		thread += parseThreads(data)
+	}
+	return process, thread
+}
+
+// parseThreads 解析 /proc/[pid]/status 中的 Threads 字段
+func parseThreads(status []byte) int {
+	idx := bytes.Index(status, []byte("\nThreads:"))
+	if idx < 0 {
+		return 1
+	}
+	line := status[idx+len("\nThreads:"):]
+	if end := bytes.IndexByte(line, '\n'); end >= 0 {
+		line = line[:end]
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(line)))
+	if err != nil {
+		return 1
+	}
+	return n
+}
+
+func isPid(name string) bool {
+	for _, c := range name {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return name != ""
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// vnstat 统计窗口
+const (
+	vnstatWindowToday = "today"
+	vnstatWindowMonth = "month"
+	vnstatWindowCycle = "cycle" // 从 traffic.reset_day 开始的账期
+)
+
+// 等待 vnstat 输出的最长时间
+const vnstatTimeout = 10 * time.Second
+
+// vnstatReport vnstat --json 的输出
+// 1.x (jsonversion 1) 以 KiB 为单位, 网卡名为 id, 日/月数据为 days/months;
+// 2.x (jsonversion 2) 以字节为单位, 网卡名为 name, 日/月数据为 day/month
+type vnstatReport struct {
+	VnstatVersion string            `json:"vnstatversion"`
+	JSONVersion   string            `json:"jsonversion"`
+	Interfaces    []vnstatInterface `json:"interfaces"`
+}
+
+type vnstatInterface struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Traffic struct {
+		Total  vnstatEntry   `json:"total"`
+		Days   []vnstatEntry `json:"days"`
+		Day    []vnstatEntry `json:"day"`
+		Months []vnstatEntry `json:"months"`
+		Month  []vnstatEntry `json:"month"`
+	} `json:"traffic"`
+}
+
+type vnstatEntry struct {
+	Date struct {
+		Year  int `json:"year"`
+		Month int `json:"month"`
+		Day   int `json:"day"`
+	} `json:"date"`
+	Rx uint64 `json:"rx"`
+	Tx uint64 `json:"tx"`
+}
+
+// vnstatTraffic 统一 1.x 与 2.x 格式后的网卡数据, 单位为字节
+type vnstatTraffic struct {
+	name         string
+	total        vnstatEntry
+	days, months []vnstatEntry
+}
+
+// parseVnstat 解析 vnstat --json 的输出并识别版本
+func parseVnstat(data []byte) ([]vnstatTraffic, error) {
+	var report vnstatReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("解析 vnstat 输出失败: %w", err)
+	}
+
+	var unit uint64
+	switch report.JSONVersion {
+	case "1":
+		unit = 1024
+	case "2":
+		unit = 1
+	default:
+		return nil, fmt.Errorf("不支持的 vnstat JSON 版本 %q (vnstat %s)", report.JSONVersion, report.VnstatVersion)
+	}
+
+	ifaces := make([]vnstatTraffic, 0, len(report.Interfaces))
+	for _, iface := range report.Interfaces {
+		t := vnstatTraffic{
+			name:   iface.Name,
+			total:  iface.Traffic.Total,
+			days:   append(iface.Traffic.Days, iface.Traffic.Day...),
+			months: append(iface.Traffic.Months, iface.Traffic.Month...),
+		}
+		if t.name == "" {
+			t.name = iface.ID
+		}
+		t.total.Rx, t.total.Tx = t.total.Rx*unit, t.total.Tx*unit
+		for _, entries := range [][]vnstatEntry{t.days, t.months} {
+			for i := range entries {
+				entries[i].Rx *= unit
+				entries[i].Tx *= unit
+			}
+		}
+		ifaces = append(ifaces, t)
+	}
+	return ifaces, nil
+}
+
+// selectVnstatInterfaces 选出参与统计的网卡
+// names 为空时按 interfaces 配置从数据库中的网卡里挑选, 与内置的流量统计保持一致
+func selectVnstatInterfaces(ifaces []vnstatTraffic, names []string, allowed func(string) bool) ([]vnstatTraffic, error) {
+	var selected []vnstatTraffic
+	if len(names) == 0 {
+		for _, iface := range ifaces {
+			if allowed(iface.name) {
+				selected = append(selected, iface)
+			}
+		}
+		if len(selected) == 0 {
+			return nil, errors.New("vnstat 数据库中没有参与统计的网卡")
+		}
+		return selected, nil
+	}
+
+	for _, name := range names {
+		found := false
+		for _, iface := range ifaces {
+			if iface.name == name {
+				selected = append(selected, iface)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("vnstat 数据库中没有网卡 %s", name)
+		}
+	}
+	return selected, nil
+}
+
+// vnstatUsage 汇总网卡在统计窗口内的流量
+func vnstatUsage(ifaces []vnstatTraffic, window string, resetDay int, now time.Time) (rx, tx uint64, err error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for _, iface := range ifaces {
+		if len(iface.days) == 0 && len(iface.months) == 0 {
+			return 0, 0, fmt.Errorf("网卡 %s 的 vnstat 数据库尚未就绪", iface.name)
+		}
+
+		switch window {
+		case vnstatWindowToday:
+			for _, e := range iface.days {
+				if e.Date.Year == now.Year() && e.Date.Month == int(now.Month()) && e.Date.Day == now.Day() {
+					rx, tx = rx+e.Rx, tx+e.Tx
+				}
+			}
+		case vnstatWindowMonth:
+			for _, e := range iface.months {
+				if e.Date.Year == now.Year() && e.Date.Month == int(now.Month()) {
+					rx, tx = rx+e.Rx, tx+e.Tx
+				}
+			}
+		case vnstatWindowCycle:
+			start := cycleStart(now, resetDay)
+			for _, e := range iface.days {
+				day := time.Date(e.Date.Year, time.Month(e.Date.Month), e.Date.Day, 0, 0, 0, 0, now.Location())
+				if !day.Before(start) && !day.After(today) {
+					rx, tx = rx+e.Rx, tx+e.Tx
+				}
+			}
+		default:
+			return 0, 0, fmt.Errorf("未知的 vnstat 统计窗口 %q", window)
+		}
+	}
+	return rx, tx, nil
+}
+
+// trafficVnstat 通过 vnstat --json 获取所选网卡在统计窗口内的流量
+func trafficVnstat(cfg *Config) (uint64, uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), vnstatTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "vnstat", "--json").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return 0, 0, fmt.Errorf("执行 vnstat 失败: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return 0, 0, fmt.Errorf("执行 vnstat 失败: %w", err)
+	}
+
+	ifaces, err := parseVnstat(out)
+	if err != nil {
+		return 0, 0, err
+	}
+	ifaces, err = selectVnstatInterfaces(ifaces, cfg.Traffic.Vnstat.Interfaces, func(dev string) bool {
+		return cfg.Interfaces.allowed(dev, interfaceTypes(dev))
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return vnstatUsage(ifaces, cfg.Traffic.Vnstat.Window, cfg.Traffic.ResetDay, time.Now())
+}
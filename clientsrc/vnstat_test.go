@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func loadVnstatFixture(t *testing.T, name string) []vnstatTraffic {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ifaces, err := parseVnstat(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ifaces
+}
+
+// 两个版本的测试数据记录的是同一份流量, 1.x 以 KiB 为单位, 2.x 以字节为单位
+func TestVnstatUsage(t *testing.T) {
+	now := time.Date(2022, 3, 16, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		window   string
+		resetDay int
+		rx, tx   uint64
+	}{
+		{vnstatWindowToday, 1, 1048576, 2097152},
+		{vnstatWindowMonth, 1, 7340032, 5242880},
+		{vnstatWindowCycle, 5, 7340032, 5242880},
+		{vnstatWindowCycle, 10, 5242880, 3145728},
+		{vnstatWindowCycle, 28, 15728640, 9437184},
+	}
+
+	for _, fixture := range []string{"vnstat1.json", "vnstat2.json"} {
+		ifaces, err := selectVnstatInterfaces(loadVnstatFixture(t, fixture), []string{"eth0"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range tests {
+			rx, tx, err := vnstatUsage(ifaces, tt.window, tt.resetDay, now)
+			if err != nil {
+				t.Fatalf("%s %s: %v", fixture, tt.window, err)
+			}
+			if rx != tt.rx || tx != tt.tx {
+				t.Errorf("%s %s/%d = %d/%d, want %d/%d", fixture, tt.window, tt.resetDay, rx, tx, tt.rx, tt.tx)
+			}
+		}
+	}
+}
+
+func TestVnstatMultipleInterfaces(t *testing.T) {
+	now := time.Date(2022, 3, 16, 12, 0, 0, 0, time.Local)
+	ifaces, err := selectVnstatInterfaces(loadVnstatFixture(t, "vnstat1.json"), []string{"eth0", "eth1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rx, tx, err := vnstatUsage(ifaces, vnstatWindowToday, 1, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rx != (1024+100)*1024 || tx != (2048+200)*1024 {
+		t.Errorf("today = %d/%d", rx, tx)
+	}
+
+	// 未指定网卡时按过滤函数选择
+	ifaces, err = selectVnstatInterfaces(loadVnstatFixture(t, "vnstat2.json"), nil, func(dev string) bool {
+		return dev == "eth0"
+	})
+	if err != nil || len(ifaces) != 1 || ifaces[0].name != "eth0" {
+		t.Errorf("selected %v, %v", ifaces, err)
+	}
+}
+
+func TestVnstatErrors(t *testing.T) {
+	now := time.Date(2022, 3, 16, 12, 0, 0, 0, time.Local)
+	ifaces := loadVnstatFixture(t, "vnstat2.json")
+
+	if _, err := selectVnstatInterfaces(ifaces, []string{"eth9"}, nil); err == nil || !strings.Contains(err.Error(), "eth9") {
+		t.Errorf("missing interface: %v", err)
+	}
+	if _, err := selectVnstatInterfaces(ifaces, nil, func(string) bool { return false }); err == nil {
+		t.Error("no interface selected, want error")
+	}
+
+	// 刚加入数据库的网卡还没有日/月数据
+	fresh, err := selectVnstatInterfaces(ifaces, []string{"wlan0"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := vnstatUsage(fresh, vnstatWindowMonth, 1, now); err == nil || !strings.Contains(err.Error(), "尚未就绪") {
+		t.Errorf("empty database: %v", err)
+	}
+
+	if _, err := parseVnstat([]byte(`{"vnstatversion":"3.0","jsonversion":"3","interfaces":[]}`)); err == nil {
+		t.Error("unknown json version, want error")
+	}
+	if _, err := parseVnstat([]byte("Error: Unable to open database")); err == nil {
+		t.Error("invalid json, want error")
+	}
+}